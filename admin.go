@@ -0,0 +1,616 @@
+package main
+
+/* The admin console, /admin.
+ *
+ * Administrators (see isAdmin) can list the users, reset a user's
+ * password, change a nickname, disable, enable or delete an account,
+ * make other users administrators, view and change anybody's picks
+ * for a week of the current season and rescore the season.  They can
+ * also set a game's result when the schedule page has it wrong; the
+ * game is flagged with Override and updateGames() leaves it alone
+ * until the override is cleared.  Every change is written to the
+ * audit log, see audit.go. */
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+const auditShown = 200
+
+/* The logged in administrator, or nil after sending
+ * the client somewhere else */
+func adminUser(w http.ResponseWriter, r *http.Request) *User {
+	user := getSessionUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return nil
+	}
+
+	if !isAdmin(user) {
+		log.Println("admin: user", user.Email, "is not an admin")
+		http.Error(w, "not allowed", http.StatusForbidden)
+		return nil
+	}
+
+	return user
+}
+
+/* Caller must hold the store lock, at least for reading.
+ * The user named in the path after prefix. */
+func adminPathUser(w http.ResponseWriter, r *http.Request, prefix string) (*User, []string) {
+	f := func(c rune) bool { return c == '/' }
+	fields := strings.FieldsFunc(strings.TrimPrefix(r.URL.Path, prefix), f)
+	if len(fields) == 0 {
+		errorPage(w, "expecting %s<email>, got %s", prefix, html.EscapeString(r.URL.Path))
+		return nil, nil
+	}
+
+	player, ok := store.users[fields[0]]
+	if !ok {
+		errorPage(w, "No user %s", html.EscapeString(fields[0]))
+		return nil, nil
+	}
+
+	return player, fields[1:]
+}
+
+/**********************************************************/
+
+func adminGetHandler(w http.ResponseWriter, r *http.Request) {
+	admin := adminUser(w, r)
+	if admin == nil {
+		return
+	}
+
+	type UserRow struct {
+		Email    string
+		Name     string
+		Admin    bool
+		Disabled bool
+		Points   int
+		Leagues  int
+	}
+
+	users := make([]UserRow, 0, len(store.users))
+	for _, u := range store.users {
+		points := 0
+		for _, uw := range u.UserWeeks {
+			points += uw.Points
+		}
+		users = append(users, UserRow{
+			Email:    u.Email,
+			Name:     u.Name,
+			Admin:    isAdmin(u),
+			Disabled: u.Disabled,
+			Points:   points,
+			Leagues:  len(leaguesOf(u)),
+		})
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+
+	type WeekRow struct {
+		Indx      int
+		Name      string
+		Overrides int
+	}
+
+	weeks := make([]WeekRow, 0, len(store.season.Week))
+	for i := range store.season.Week {
+		overrides := 0
+		for _, game := range store.season.Week[i].Games {
+			if game.Override {
+				overrides++
+			}
+		}
+		weeks = append(weeks, WeekRow{Indx: i, Name: store.season.Week[i].name(), Overrides: overrides})
+	}
+
+	data := struct {
+		Name  string
+		Year  int
+		Users []UserRow
+		Weeks []WeekRow
+	}{
+		Name:  admin.Name,
+		Year:  store.season.Year,
+		Users: users,
+		Weeks: weeks,
+	}
+
+	err := templates.ExecuteTemplate(w, "admin.html", &data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func adminUserGetHandler(w http.ResponseWriter, r *http.Request) {
+	admin := adminUser(w, r)
+	if admin == nil {
+		return
+	}
+
+	player, _ := adminPathUser(w, r, "/admin/user/")
+	if player == nil {
+		return
+	}
+
+	type WeekRow struct {
+		Indx   int
+		Name   string
+		Picks  int
+		Points int
+	}
+
+	weeks := make([]WeekRow, 0, len(store.season.Week))
+	for i := range store.season.Week {
+		weeks = append(weeks, WeekRow{
+			Indx:   i,
+			Name:   store.season.Week[i].name(),
+			Picks:  len(player.UserWeeks[i].Selections),
+			Points: player.UserWeeks[i].Points,
+		})
+	}
+
+	data := struct {
+		Name        string
+		Player      *User
+		PlayerAdmin bool
+		Self        bool
+		Configured  bool
+		Leagues     []*League
+		Year        int
+		Weeks       []WeekRow
+	}{
+		Name:        admin.Name,
+		Player:      player,
+		PlayerAdmin: isAdmin(player),
+		Self:        player == admin,
+		Configured:  player.Email == options.AdminEmail,
+		Leagues:     leaguesOf(player),
+		Year:        store.season.Year,
+		Weeks:       weeks,
+	}
+
+	err := templates.ExecuteTemplate(w, "adminuser.html", &data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func adminUserPostHandler(w http.ResponseWriter, r *http.Request) {
+	admin := adminUser(w, r)
+	if admin == nil {
+		return
+	}
+
+	player, _ := adminPathUser(w, r, "/admin/User/")
+	if player == nil {
+		return
+	}
+
+	action := r.FormValue("action")
+	switch action {
+	case "password":
+		pass := r.FormValue("password")
+		if err := validatePassword(pass, r.FormValue("password2")); err != nil {
+			errorPage(w, "%s", err.Error())
+			return
+		}
+		pwHash, err := hashPassword(pass)
+		if err != nil {
+			log.Println("admin: cannot hash password for", player.Email, ":", err.Error())
+			errorPage(w, "Internal error, could not set the password for %s", player.Email)
+			return
+		}
+		player.PwHash = pwHash
+		player.SessionGen++
+		writeUserFile(player)
+		audit(admin, "password", player.Email, "reset password")
+
+		body := "hi\nThe administrator set a new password for your FB Confidence Pool account.\n"
+		if err := emailUser(player, EmailSecurity, "FB Confidence Pool password changed", body); err != nil {
+			log.Println("admin: queueing password email to", player.Email, "failed:", err.Error())
+		}
+
+	case "rename":
+		nick := r.FormValue("nickname")
+		if err := validateNickname(nick, player); err != nil {
+			errorPage(w, "%s", err.Error())
+			return
+		}
+		old := player.Name
+		player.Name = nick
+		writeUserFile(player)
+		audit(admin, "rename", player.Email, "%s to %s", old, nick)
+
+	case "disable", "enable":
+		if player == admin {
+			errorPage(w, "You can not disable yourself")
+			return
+		}
+		player.Disabled = action == "disable"
+		if player.Disabled {
+			/* log them out everywhere */
+			player.SessionGen++
+		}
+		writeUserFile(player)
+		audit(admin, action, player.Email, "")
+
+	case "admin", "unadmin":
+		if player == admin {
+			errorPage(w, "You can not change your own admin role")
+			return
+		}
+		player.Admin = action == "admin"
+		writeUserFile(player)
+		audit(admin, action, player.Email, "")
+
+	case "delete":
+		if player == admin {
+			errorPage(w, "You can not delete yourself")
+			return
+		}
+		if r.FormValue("confirm") != player.Email {
+			errorPage(w, "Type the email address %s to delete the account", player.Email)
+			return
+		}
+
+		if err := userStore.Delete(player.Email); err != nil {
+			log.Println("admin: delete", player.Email, ":", err.Error())
+			errorPage(w, "Could not delete %s: %s", player.Email, err.Error())
+			return
+		}
+		delete(store.users, player.Email)
+
+		for _, l := range store.leagues {
+			if l.isMember(player.Email) {
+				l.removeMember(player.Email)
+			}
+		}
+		if err := saveLeagues(); err != nil {
+			log.Println("Could not save leagues:", err.Error())
+		}
+
+		audit(admin, "delete", player.Email, "nickname %s", player.Name)
+		http.Redirect(w, r, "/admin", http.StatusFound)
+		return
+
+	default:
+		errorPage(w, "Unknown action %s", html.EscapeString(action))
+		return
+	}
+
+	http.Redirect(w, r, "/admin/user/"+player.Email, http.StatusFound)
+}
+
+/**********************************************************/
+
+/* Caller must hold the store lock, at least for reading */
+func adminPathWeek(w http.ResponseWriter, r *http.Request, prefix string) (*User, int) {
+	player, rest := adminPathUser(w, r, prefix)
+	if player == nil {
+		return nil, 0
+	}
+
+	if len(rest) != 1 {
+		errorPage(w, "expecting %s<email>/<week index>, got %s", prefix, html.EscapeString(r.URL.Path))
+		return nil, 0
+	}
+
+	iw, err := strconv.Atoi(rest[0])
+	if err != nil || iw < 0 || iw >= len(store.season.Week) || iw >= len(player.UserWeeks) {
+		errorPage(w, "No week index %s", html.EscapeString(rest[0]))
+		return nil, 0
+	}
+
+	return player, iw
+}
+
+func adminPicksGetHandler(w http.ResponseWriter, r *http.Request) {
+	admin := adminUser(w, r)
+	if admin == nil {
+		return
+	}
+
+	player, iw := adminPathWeek(w, r, "/admin/picks/")
+	if player == nil {
+		return
+	}
+
+	type GameRow struct {
+		TeamV      string
+		TeamH      string
+		Status     string
+		Score      string
+		Pick       string
+		Confidence int
+	}
+
+	week := &store.season.Week[iw]
+	games := make([]GameRow, 0, len(week.Games))
+	for _, game := range week.Games {
+		row := GameRow{TeamV: game.TeamV, TeamH: game.TeamH, Status: game.Status.String()}
+		if game.Status != Future {
+			row.Score = game.ScoreV + " to " + game.ScoreH
+		}
+		for _, s := range player.UserWeeks[iw].Selections {
+			if s.Team == game.TeamV || s.Team == game.TeamH {
+				row.Pick = s.Team
+				row.Confidence = s.Confidence
+				break
+			}
+		}
+		games = append(games, row)
+	}
+
+	data := struct {
+		Name          string
+		Player        *User
+		IWeek         int
+		WeekName      string
+		Points        int
+		MaxConfidence int
+		Games         []GameRow
+		Tiebreaker    *TiebreakerTmpl
+		Survivor      bool
+		SurvivorPick  string
+	}{
+		Name:          admin.Name,
+		Player:        player,
+		IWeek:         iw,
+		WeekName:      week.name(),
+		Points:        player.UserWeeks[iw].Points,
+		MaxConfidence: week.maxConfidence(),
+		Games:         games,
+		Tiebreaker:    makeTiebreakerTmpl(player, iw),
+		Survivor:      len(survivorLeagues(player)) > 0 && !week.Playoff,
+		SurvivorPick:  player.UserWeeks[iw].survivorPick(),
+	}
+
+	err := templates.ExecuteTemplate(w, "adminpicks.html", &data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func adminPicksPostHandler(w http.ResponseWriter, r *http.Request) {
+	admin := adminUser(w, r)
+	if admin == nil {
+		return
+	}
+
+	player, iw := adminPathWeek(w, r, "/admin/Picks/")
+	if player == nil {
+		return
+	}
+
+	before := fmt.Sprint(player.UserWeeks[iw].Selections, " tiebreaker ", player.UserWeeks[iw].Tiebreaker)
+
+	/* the form has, for each game, the picked team or
+	 * nothing and the confidence */
+	choose := func(game Game) (string, int, bool) {
+		team := r.FormValue("team" + game.TeamV)
+		if team == "" {
+			return "", 0, true
+		}
+		confidence, err := strconv.Atoi(r.FormValue("confidence" + game.TeamV))
+		if err != nil {
+			/* savePicks will complain about it */
+			confidence = 0
+		}
+		return team, confidence, true
+	}
+
+	if err := adminSavePicks(player, iw, choose); err != nil {
+		errorPage(w, "%s", err.Error())
+		return
+	}
+
+	/* the survivor pick, none takes it away */
+	if len(survivorLeagues(player)) > 0 && !store.season.Week[iw].Playoff {
+		old := player.UserWeeks[iw].survivorPick()
+		if team := r.FormValue("survivor"); team != old {
+			if err := saveSurvivorPick(player, iw, team, true); err != nil {
+				errorPage(w, "%s", err.Error())
+				return
+			}
+			audit(admin, "survivor", player.Email, "%s from %q to %q", store.season.Week[iw].name(), old, team)
+		}
+	}
+	if store.season.Week[iw].tiebreakerGame() != nil {
+		total := 0
+		if s := r.FormValue("tiebreaker"); s != "" {
+			total, _ = strconv.Atoi(s)
+		}
+		if err := setTiebreaker(player, iw, total, true); err != nil {
+			errorPage(w, "%s", err.Error())
+			return
+		}
+	}
+	updateUserScoresWeekIndex(iw)
+
+	audit(admin, "picks", player.Email, "%s from %s to %v tiebreaker %d", store.season.Week[iw].name(),
+		before, player.UserWeeks[iw].Selections, player.UserWeeks[iw].Tiebreaker)
+
+	http.Redirect(w, r, "/admin/user/"+player.Email, http.StatusFound)
+}
+
+/**********************************************************/
+
+/* Caller must hold the store lock, at least for reading */
+func adminPathWeekIndex(w http.ResponseWriter, r *http.Request, prefix string) (int, bool) {
+	field := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	iw, err := strconv.Atoi(field)
+	if err != nil || iw < 0 || iw >= len(store.season.Week) {
+		errorPage(w, "No week index %s", html.EscapeString(field))
+		return 0, false
+	}
+	return iw, true
+}
+
+func adminGamesGetHandler(w http.ResponseWriter, r *http.Request) {
+	admin := adminUser(w, r)
+	if admin == nil {
+		return
+	}
+
+	iw, ok := adminPathWeekIndex(w, r, "/admin/games/")
+	if !ok {
+		return
+	}
+
+	week := &store.season.Week[iw]
+	tiebreaker := ""
+	if game := week.tiebreakerGame(); game != nil {
+		tiebreaker = game.TeamV
+	}
+	data := struct {
+		Name       string
+		IWeek      int
+		WeekName   string
+		Games      []Game
+		Tiebreaker string
+	}{
+		Name:       admin.Name,
+		IWeek:      iw,
+		WeekName:   week.name(),
+		Tiebreaker: tiebreaker,
+		Games:      week.Games,
+	}
+
+	err := templates.ExecuteTemplate(w, "admingames.html", &data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func adminGamePostHandler(w http.ResponseWriter, r *http.Request) {
+	admin := adminUser(w, r)
+	if admin == nil {
+		return
+	}
+
+	iw, ok := adminPathWeekIndex(w, r, "/admin/Game/")
+	if !ok {
+		return
+	}
+
+	game := store.season.Week[iw].teamToGame[r.FormValue("team")]
+	if game == nil {
+		errorPage(w, "No game for %s in week index %d", html.EscapeString(r.FormValue("team")), iw)
+		return
+	}
+	before := fmt.Sprintf("%s %s to %s", game.Status, game.ScoreV, game.ScoreH)
+
+	switch r.FormValue("action") {
+	case "set":
+		scoreV, errV := strconv.Atoi(r.FormValue("scoreV"))
+		scoreH, errH := strconv.Atoi(r.FormValue("scoreH"))
+		if errV != nil || errH != nil || scoreV < 0 || scoreH < 0 {
+			errorPage(w, "Scores must be numbers")
+			return
+		}
+
+		switch r.FormValue("status") {
+		case "finished":
+			game.Status = Finished
+			game.Time = "FINAL"
+		case "inprogress":
+			game.Status = InProgress
+			game.Time = "in progress"
+		default:
+			errorPage(w, "Unknown game status %s", html.EscapeString(r.FormValue("status")))
+			return
+		}
+		game.ScoreV = strconv.Itoa(scoreV)
+		game.ScoreH = strconv.Itoa(scoreH)
+		game.Override = true
+		audit(admin, "game", game.TeamV+" at "+game.TeamH, "%s from %s to %s %s to %s",
+			store.season.Week[iw].name(), before, game.Status, game.ScoreV, game.ScoreH)
+
+	case "clear":
+		/* the next update from the schedule page sets the result */
+		game.Override = false
+		audit(admin, "game", game.TeamV+" at "+game.TeamH, "%s cleared override of %s",
+			store.season.Week[iw].name(), before)
+
+	case "spread":
+		if !spreadsUsed() {
+			errorPage(w, "There are no against the spread leagues")
+			return
+		}
+		spread, err := strconv.ParseFloat(r.FormValue("spread"), 64)
+		if err != nil {
+			errorPage(w, "The spread must be a number")
+			return
+		}
+		old := game.Spread
+		if err := setSpread(game, spread, time.Now()); err != nil {
+			errorPage(w, "%s", err.Error())
+			return
+		}
+		audit(admin, "spread", game.TeamV+" at "+game.TeamH, "%s from %v to %v",
+			store.season.Week[iw].name(), old, game.Spread)
+
+	case "tiebreaker":
+		if !options.Tiebreaker {
+			errorPage(w, "The tiebreaker is not turned on")
+			return
+		}
+		store.season.Week[iw].Tiebreaker = game.TeamV
+		audit(admin, "tiebreaker", game.TeamV+" at "+game.TeamH, "%s", store.season.Week[iw].name())
+
+	default:
+		errorPage(w, "Unknown action %s", html.EscapeString(r.FormValue("action")))
+		return
+	}
+
+	if err := saveSeason(); err != nil {
+		log.Println("Could not save season:", err.Error())
+	}
+	updateUserScoresWeekIndex(iw)
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/games/%d", iw), http.StatusFound)
+}
+
+/**********************************************************/
+
+func adminRescorePostHandler(w http.ResponseWriter, r *http.Request) {
+	admin := adminUser(w, r)
+	if admin == nil {
+		return
+	}
+
+	updateUserScores()
+	audit(admin, "rescore", fmt.Sprint(store.season.Year), "")
+
+	http.Redirect(w, r, "/admin", http.StatusFound)
+}
+
+func adminAuditGetHandler(w http.ResponseWriter, r *http.Request) {
+	admin := adminUser(w, r)
+	if admin == nil {
+		return
+	}
+
+	data := struct {
+		Name    string
+		Entries []AuditEntry
+	}{
+		Name:    admin.Name,
+		Entries: readAudit(auditShown),
+	}
+
+	err := templates.ExecuteTemplate(w, "audit.html", &data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
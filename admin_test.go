@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAdmin(t *testing.T) {
+	newTestStore(t, 2022, []Game{finalGame("CHI", "GB", 21, 7, 1)}, nil)
+	store.iWeek = 1
+	initOutbox()
+	mux := newMux()
+
+	cookies := make(map[string]*http.Cookie)
+	for _, name := range []string{"boss", "fred"} {
+		cookies[name] = testCookie(addTestUser(name))
+	}
+	store.users["boss@foo.com"].Admin = true
+	fred := store.users["fred@foo.com"]
+
+	do := func(who string, method string, path string, form url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(cookies[who])
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := do("fred", "GET", "/admin", nil); w.Code != http.StatusForbidden {
+		t.Error("fred got the admin console, status", w.Code)
+	}
+	for _, path := range []string{"/admin", "/admin/user/fred@foo.com", "/admin/picks/fred@foo.com/0"} {
+		if w := do("boss", "GET", path, nil); w.Code != http.StatusOK {
+			t.Error(path, "status", w.Code)
+		}
+	}
+
+	do("boss", "POST", "/admin/User/fred@foo.com", url.Values{"action": {"rename"}, "nickname": {"freddy"}})
+	if fred.Name != "freddy" {
+		t.Error("fred not renamed", fred.Name)
+	}
+
+	/* the game is over, but the admin can still change the pick */
+	do("boss", "POST", "/admin/Picks/fred@foo.com/0", url.Values{"teamCHI": {"CHI"}, "confidenceCHI": {"5"}})
+	if len(fred.UserWeeks[0].Selections) != 1 || fred.UserWeeks[0].Points != 5 {
+		t.Error("pick not saved and scored", fred.UserWeeks[0])
+	}
+
+	/* the admin's result sticks until it is cleared */
+	if w := do("boss", "GET", "/admin/games/0", nil); w.Code != http.StatusOK {
+		t.Error("/admin/games/0 status", w.Code)
+	}
+	do("boss", "POST", "/admin/Game/0", url.Values{"team": {"CHI"}, "action": {"set"}, "status": {"finished"}, "scoreV": {"7"}, "scoreH": {"21"}})
+	if fred.UserWeeks[0].Points != 0 {
+		t.Error("not rescored after the override", fred.UserWeeks[0].Points)
+	}
+	scraped := []Game{finalGame("CHI", "GB", 21, 7, 1)}
+	updateWeekGames(0, scraped)
+	if g := store.season.Week[0].Games[0]; !g.Override || g.ScoreV != "7" || fred.UserWeeks[0].Points != 0 {
+		t.Error("override replaced by the schedule", g)
+	}
+	do("boss", "POST", "/admin/Game/0", url.Values{"team": {"CHI"}, "action": {"clear"}})
+	updateWeekGames(0, scraped)
+	if g := store.season.Week[0].Games[0]; g.Override || g.ScoreV != "21" || fred.UserWeeks[0].Points != 5 {
+		t.Error("cleared override not updated from the schedule", g)
+	}
+
+	do("boss", "POST", "/admin/User/fred@foo.com", url.Values{"action": {"disable"}})
+	if !fred.Disabled {
+		t.Fatal("fred not disabled")
+	}
+	if w := do("fred", "GET", "/user", nil); w.Code != http.StatusInternalServerError {
+		t.Error("disabled fred can still use the session, status", w.Code)
+	}
+
+	entries := readAudit(10)
+	if len(entries) != 5 || entries[0].Action != "disable" || entries[1].Action != "game" || entries[4].Action != "rename" || entries[4].Admin != "boss@foo.com" {
+		t.Error("wrong audit log", entries)
+	}
+}
@@ -0,0 +1,396 @@
+package main
+
+/* JSON API, version 1
+ *
+ *   GET  /api/v1/weeks                          all the weeks and their games
+ *   GET  /api/v1/weeks/<week index>             one week and its games
+ *   GET  /api/v1/picks/<week index>             the logged in user's picks
+ *   POST /api/v1/picks/<week index>             save picks, the body is
+ *                                               [{"team":"Bears","confidence":16}, ...]
+ *                                               and ?tiebreaker=<total points> if
+ *                                               the week has a tiebreaker game.
+ *                                               Picks for games that have started
+ *                                               are not saved, "skipped" lists them
+ *   POST /api/v1/picks/<week index>?survivor=1  save the survivor pick, the body is
+ *                                               just the one team
+ *   GET  /api/v1/results/<email>/<week index>   how a player's picks did, for
+ *                                               a player in one of your leagues
+ *   GET  /api/v1/standings                      the standings of your leagues
+ *   GET  /api/v1/standings?playoffs=1           the playoff leaderboard
+ *   GET  /api/v1/standings?league=<id>          a league's standings
+ *
+ * Teams are given by their ID, "CHI", see teams.go.  Picks can also
+ * name the team any way the registry knows, "Bears".  Games have a
+ * spread, the points given to the home team, when there are against
+ * the spread leagues, and results for one of them a line, see
+ * spread.go.
+ *
+ * results and standings take ?season=<year> for an earlier season
+ * and ?league=<id> for a league, see league.go.
+ * Week indexes start at 0, like the HTML pages.  Everything but the
+ * standings needs the session cookie from /login.  Errors come back
+ * as {"error":"..."} with an HTTP error status. */
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const apiPrefix = "/api/v1/"
+
+type apiGame struct {
+	TeamV   string     `json:"visitor"`
+	TeamH   string     `json:"home"`
+	NameV   string     `json:"visitorName"`
+	NameH   string     `json:"homeName"`
+	ScoreV  string     `json:"visitorScore,omitempty"`
+	ScoreH  string     `json:"homeScore,omitempty"`
+	Status  string     `json:"status"`
+	Kickoff *time.Time `json:"kickoff,omitempty"`
+	Spread  float64    `json:"spread,omitempty"` // points given to the home team, see spread.go
+}
+
+type apiWeek struct {
+	Index         int       `json:"index"`
+	Num           int       `json:"week"`
+	Label         string    `json:"label,omitempty"`
+	Playoff       bool      `json:"playoff,omitempty"`
+	MaxConfidence int       `json:"maxConfidence"`
+	Start         string    `json:"start"`
+	End           string    `json:"end"`
+	Tiebreaker    string    `json:"tiebreaker,omitempty"` // visiting team of the tiebreaker game
+	Games         []apiGame `json:"games"`
+}
+
+type apiPick struct {
+	Team       string `json:"team"`
+	Confidence int    `json:"confidence"`
+	When       string `json:"when,omitempty"`
+}
+
+type apiPicks struct {
+	Index      int       `json:"index"`
+	Num        int       `json:"week"`
+	Points     int       `json:"points"`
+	GoodPicks  int       `json:"goodPicks"`
+	Tiebreaker int       `json:"tiebreaker,omitempty"`
+	Picks      []apiPick `json:"picks"`
+	Survivor   string    `json:"survivor,omitempty"` // the survivor pick, see survivor.go
+	Skipped    []string  `json:"skipped,omitempty"`  // picks not saved, their games had started
+}
+
+type apiResults struct {
+	Player     string       `json:"player"`
+	Year       int          `json:"season"`
+	Index      int          `json:"index"`
+	Num        int          `json:"week"`
+	Points     int          `json:"points"`
+	Finished   []ResultsRow `json:"finished"`
+	InProgress []ResultsRow `json:"inProgress"`
+	Future     []ResultsRow `json:"future"`
+}
+
+/**********************************************************/
+
+func apiWrite(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Println("api: encode:", err.Error())
+	}
+}
+
+func apiError(w http.ResponseWriter, status int, format string, a ...interface{}) {
+	apiWrite(w, status, struct {
+		Error string `json:"error"`
+	}{fmt.Sprintf(format, a...)})
+}
+
+/* The fields of the path after /api/v1/<what>/ */
+func apiFields(r *http.Request, what string) []string {
+	rest := strings.TrimPrefix(r.URL.Path, apiPrefix+what)
+	return strings.FieldsFunc(rest, func(c rune) bool { return c == '/' })
+}
+
+/* Caller must hold the store lock.  The week index of one of
+ * season's weeks, the current season or one in the archive. */
+func apiWeekIndex(w http.ResponseWriter, season *Season, field string) (int, bool) {
+	iw, err := strconv.Atoi(field)
+	if err != nil || iw < 0 || iw >= len(season.Week) {
+		apiError(w, http.StatusNotFound, "no week index %s", field)
+		return 0, false
+	}
+	return iw, true
+}
+
+func apiUser(w http.ResponseWriter, r *http.Request) *User {
+	user := getSessionUser(r)
+	if user == nil {
+		apiError(w, http.StatusUnauthorized, "not logged in")
+	}
+	return user
+}
+
+/* Caller must hold the store lock */
+func makeApiWeek(iw int) apiWeek {
+	week := &store.season.Week[iw]
+	aw := apiWeek{
+		Index:         iw,
+		Num:           week.Num,
+		Label:         week.Label,
+		Playoff:       week.Playoff,
+		MaxConfidence: week.maxConfidence(),
+		Start:         week.weekStart.Format("2006-01-02"),
+		End:           week.weekEnd.Format("2006-01-02"),
+		Games:         make([]apiGame, 0, len(week.Games)),
+	}
+	if game := week.tiebreakerGame(); game != nil {
+		aw.Tiebreaker = game.TeamV
+	}
+
+	for _, game := range week.Games {
+		ag := apiGame{
+			TeamV:  game.TeamV,
+			TeamH:  game.TeamH,
+			NameV:  teams.name(game.TeamV, store.season.Year),
+			NameH:  teams.name(game.TeamH, store.season.Year),
+			ScoreV: game.ScoreV,
+			ScoreH: game.ScoreH,
+			Status: game.Status.String(),
+			Spread: game.Spread,
+		}
+		if game.Status == Future {
+			kickoff := game.Day.AddDayTime(game.Time)
+			ag.Kickoff = &kickoff
+		}
+		aw.Games = append(aw.Games, ag)
+	}
+
+	return aw
+}
+
+/* Caller must hold the store lock */
+func makeApiPicks(user *User, iw int) apiPicks {
+	uw := &user.UserWeeks[iw]
+	ap := apiPicks{
+		Index:      iw,
+		Num:        store.season.Week[iw].Num,
+		Points:     uw.Points,
+		GoodPicks:  uw.GoodPicks,
+		Tiebreaker: uw.Tiebreaker,
+		Picks:      make([]apiPick, 0, len(uw.Selections)),
+		Survivor:   uw.Survivor,
+	}
+	for _, s := range uw.Selections {
+		ap.Picks = append(ap.Picks, apiPick{Team: s.Team, Confidence: s.Confidence, When: s.When})
+	}
+	return ap
+}
+
+/**********************************************************/
+
+func apiWeeksHandler(w http.ResponseWriter, r *http.Request) {
+	if apiUser(w, r) == nil {
+		return
+	}
+
+	fields := apiFields(r, "weeks")
+	switch len(fields) {
+	case 0:
+		weeks := make([]apiWeek, 0, len(store.season.Week))
+		for iw := range store.season.Week {
+			weeks = append(weeks, makeApiWeek(iw))
+		}
+		apiWrite(w, http.StatusOK, weeks)
+	case 1:
+		iw, ok := apiWeekIndex(w, &store.season, fields[0])
+		if !ok {
+			return
+		}
+		apiWrite(w, http.StatusOK, makeApiWeek(iw))
+	default:
+		apiError(w, http.StatusNotFound, "expecting %sweeks/<week index>, got %s", apiPrefix, r.URL.Path)
+	}
+}
+
+func apiPicksHandler(w http.ResponseWriter, r *http.Request) {
+	user := apiUser(w, r)
+	if user == nil {
+		return
+	}
+
+	fields := apiFields(r, "picks")
+	if len(fields) != 1 {
+		apiError(w, http.StatusNotFound, "expecting %spicks/<week index>, got %s", apiPrefix, r.URL.Path)
+		return
+	}
+	iw, ok := apiWeekIndex(w, &store.season, fields[0])
+	if !ok {
+		return
+	}
+
+	var skipped []string
+	switch r.Method {
+	case "GET":
+	case "POST":
+		var picks []apiPick
+		if err := json.NewDecoder(r.Body).Decode(&picks); err != nil {
+			apiError(w, http.StatusBadRequest, "bad picks: %v", err)
+			return
+		}
+
+		/* every pick must be for a team playing this week,
+		 * named by its ID or anything the registry knows,
+		 * and only one team of a game can be picked */
+		byTeam := make(map[string]apiPick)
+		picked := make(map[*Game]bool)
+		now := time.Now()
+		for _, p := range picks {
+			if id, err := teams.resolve(p.Team, store.season.Year); err == nil {
+				p.Team = id
+			}
+			game := store.season.Week[iw].teamToGame[p.Team]
+			if game == nil {
+				apiError(w, http.StatusBadRequest, "%s does not play in week %d", p.Team, store.season.Week[iw].Num)
+				return
+			}
+			if picked[game] {
+				apiError(w, http.StatusBadRequest, "more than one pick for %s at %s", game.TeamV, game.TeamH)
+				return
+			}
+			picked[game] = true
+			byTeam[p.Team] = p
+			if game.started(now) {
+				skipped = append(skipped, p.Team)
+			}
+		}
+
+		if r.URL.Query().Get("survivor") != "" {
+			if len(picks) != 1 {
+				apiError(w, http.StatusBadRequest, "a survivor pick is one team, got %d", len(picks))
+				return
+			}
+			log.Println("api: user", user.Email, "saving survivor week", iw)
+			if err := saveSurvivorPick(user, iw, picks[0].Team, false); err != nil {
+				apiError(w, http.StatusBadRequest, "%s", err.Error())
+				return
+			}
+			break
+		}
+
+		choose := func(game Game) (string, int, bool) {
+			for _, team := range []string{game.TeamV, game.TeamH} {
+				if p, ok := byTeam[team]; ok {
+					return p.Team, p.Confidence, true
+				}
+			}
+			return "", 0, false
+		}
+
+		log.Println("api: user", user.Email, "saving week", iw)
+		if err := savePicks(user, iw, choose); err != nil {
+			apiError(w, http.StatusBadRequest, "%s", err.Error())
+			return
+		}
+		if tiebreaker := r.URL.Query().Get("tiebreaker"); tiebreaker != "" {
+			total, err := strconv.Atoi(tiebreaker)
+			if err == nil {
+				err = setTiebreaker(user, iw, total, false)
+			}
+			if err != nil {
+				apiError(w, http.StatusBadRequest, "tiebreaker %s: %v", tiebreaker, err)
+				return
+			}
+		}
+	default:
+		apiError(w, http.StatusMethodNotAllowed, "%s not allowed", r.Method)
+		return
+	}
+
+	ap := makeApiPicks(user, iw)
+	ap.Skipped = skipped
+	apiWrite(w, http.StatusOK, ap)
+}
+
+func apiResultsHandler(w http.ResponseWriter, r *http.Request) {
+	user := apiUser(w, r)
+	if user == nil {
+		return
+	}
+
+	fields := apiFields(r, "results")
+	if len(fields) != 2 {
+		apiError(w, http.StatusNotFound, "expecting %sresults/<email>/<week index>, got %s", apiPrefix, r.URL.Path)
+		return
+	}
+
+	player, ok := store.users[fields[0]]
+	if !ok || !canView(user, player) {
+		apiError(w, http.StatusNotFound, "no player %s", fields[0])
+		return
+	}
+
+	season := requestSeason(r)
+	if season == nil {
+		apiError(w, http.StatusNotFound, "no season %s", r.FormValue("season"))
+		return
+	}
+
+	iw, ok := apiWeekIndex(w, season, fields[1])
+	if !ok {
+		return
+	}
+	league, err := requestLeague(r, user)
+	if err != nil {
+		apiError(w, http.StatusForbidden, "%s", err.Error())
+		return
+	}
+
+	weeks := league.weeks(player, season.Year)
+	points := 0
+	if iw < len(weeks) {
+		points = weeks[iw].Points
+	}
+
+	finished, inProgress, future := weekResults(season, weeks, iw, league.ats())
+	if league.survivor() && player != user {
+		/* keep the survivor pick secret until the game starts */
+		future = make([]ResultsRow, 0)
+	}
+	apiWrite(w, http.StatusOK, apiResults{
+		Player:     player.Name,
+		Year:       season.Year,
+		Index:      iw,
+		Num:        season.Week[iw].Num,
+		Points:     points,
+		Finished:   finished,
+		InProgress: inProgress,
+		Future:     future,
+	})
+}
+
+func apiStandingsHandler(w http.ResponseWriter, r *http.Request) {
+	season := requestSeason(r)
+	if season == nil {
+		apiError(w, http.StatusNotFound, "no season %s", r.FormValue("season"))
+		return
+	}
+	league, err := requestLeague(r, getSessionUser(r))
+	if err != nil {
+		apiError(w, http.StatusForbidden, "%s", err.Error())
+		return
+	}
+
+	if r.FormValue("playoffs") != "" {
+		apiWrite(w, http.StatusOK, playoffStandings(season.Year, league))
+		return
+	}
+	apiWrite(w, http.StatusOK, seasonStandings(season.Year, league))
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestApiPicks(t *testing.T) {
+	weeks := make([][]Game, 17)
+	for i := range weeks {
+		weeks[i] = []Game{futureGame("CHI", "GB", 1), futureGame("NYJ", "NYG", 1)}
+	}
+	weeks[1][1] = finalGame("NYJ", "NYG", 3, 7, 1)
+	newTestStore(t, 2020, weeks...)
+	mux := newMux()
+
+	u := addTestUser("user")
+	cookie := testCookie(u)
+
+	do := func(method string, path string, body string, withCookie bool) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if withCookie {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := do("GET", "/api/v1/picks/0", "", false); w.Code != http.StatusUnauthorized {
+		t.Error("no session: status", w.Code)
+	}
+
+	if w := do("GET", "/api/v1/weeks/99", "", true); w.Code != http.StatusNotFound {
+		t.Error("bad week: status", w.Code)
+	}
+
+	/* repeated confidence is rejected and nothing is saved */
+	w := do("POST", "/api/v1/picks/0", `[{"team":"CHI","confidence":5},{"team":"NYG","confidence":5}]`, true)
+	if w.Code != http.StatusBadRequest {
+		t.Error("repeated confidence: status", w.Code)
+	}
+	if len(u.UserWeeks[0].Selections) != 0 {
+		t.Error("bad picks were saved:", u.UserWeeks[0].Selections)
+	}
+
+	if w := do("POST", "/api/v1/picks/0", `[{"team":"DET","confidence":5}]`, true); w.Code != http.StatusBadRequest {
+		t.Error("team not playing: status", w.Code)
+	}
+
+	w = do("POST", "/api/v1/picks/0", `[{"team":"CHI","confidence":16},{"team":"NYG","confidence":15}]`, true)
+	if w.Code != http.StatusOK {
+		t.Fatal("save picks: status", w.Code, w.Body.String())
+	}
+	var picks apiPicks
+	if err := json.Unmarshal(w.Body.Bytes(), &picks); err != nil {
+		t.Fatal(err)
+	}
+	if len(picks.Picks) != 2 || picks.Picks[0].Team != "CHI" || picks.Picks[0].Confidence != 16 {
+		t.Error("unexpected picks", picks.Picks)
+	}
+
+	if w := do("POST", "/api/v1/picks/0", `[{"team":"CHI","confidence":16},{"team":"GB","confidence":15}]`, true); w.Code != http.StatusBadRequest {
+		t.Error("both teams of a game: status", w.Code)
+	}
+
+	/* a pick for a game that has started is reported, not saved */
+	w = do("POST", "/api/v1/picks/1", `[{"team":"GB","confidence":16},{"team":"NYJ","confidence":15}]`, true)
+	if w.Code != http.StatusOK {
+		t.Fatal("save picks with a started game: status", w.Code, w.Body.String())
+	}
+	picks = apiPicks{}
+	if err := json.Unmarshal(w.Body.Bytes(), &picks); err != nil {
+		t.Fatal(err)
+	}
+	if len(picks.Skipped) != 1 || picks.Skipped[0] != "NYJ" || len(picks.Picks) != 1 || picks.Picks[0].Team != "GB" {
+		t.Error("started game not skipped", picks.Skipped, picks.Picks)
+	}
+
+	/* an archived season can have fewer weeks than this one */
+	store.archive = map[int]*Season{2019: newSeason(2019, 2)}
+	u.PastSeasons = []UserSeason{{Year: 2019, UserWeeks: newUserWeeks(17)}}
+	u.PastSeasons[0].UserWeeks[5].Selections = []Selection{{Team: "CHI", Confidence: 16}}
+	if w := do("GET", "/api/v1/results/user@foo.com/5?season=2019", "", true); w.Code != http.StatusNotFound {
+		t.Error("week past the archived season: status", w.Code)
+	}
+	if w := do("GET", "/api/v1/results/user@foo.com/1?season=2019", "", true); w.Code != http.StatusOK {
+		t.Error("archived week: status", w.Code, w.Body.String())
+	}
+
+	if w := do("GET", "/api/v1/standings", "", false); w.Code != http.StatusOK {
+		t.Error("standings: status", w.Code)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+/* What the administrators did.
+ *
+ * Every admin action is appended to options.AuditLog (default
+ * audit.log) as one line: the time, the administrator, the action,
+ * who or what it was done to and the details, separated by tabs.
+ * The file is only ever appended to; /admin/audit shows the newest
+ * entries. */
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type AuditEntry struct {
+	Time   time.Time
+	Admin  string
+	Action string
+	Target string
+	Detail string
+}
+
+var auditLock sync.Mutex
+
+func auditFileName() string {
+	if options.AuditLog != "" {
+		return options.AuditLog
+	}
+	return "audit.log"
+}
+
+/* Keeps an entry from spilling into the next field or line */
+var auditReplacer = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+
+/**********************************************************/
+
+/* Records an admin action, logging if it can not be written */
+func audit(admin *User, action string, target string, format string, a ...interface{}) {
+	fields := []string{
+		time.Now().UTC().Format(time.RFC3339),
+		auditReplacer.Replace(admin.Email),
+		auditReplacer.Replace(action),
+		auditReplacer.Replace(target),
+		auditReplacer.Replace(fmt.Sprintf(format, a...)),
+	}
+	line := strings.Join(fields, "\t") + "\n"
+
+	log.Print("audit: ", line)
+
+	auditLock.Lock()
+	defer auditLock.Unlock()
+
+	f, err := os.OpenFile(auditFileName(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Println("audit:", err.Error())
+		return
+	}
+
+	_, err = f.WriteString(line)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Println("audit:", err.Error())
+	}
+}
+
+/* The newest max entries, newest first */
+func readAudit(max int) []AuditEntry {
+	auditLock.Lock()
+	defer auditLock.Unlock()
+
+	entries := make([]AuditEntry, 0)
+
+	f, err := os.Open(auditFileName())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("audit:", err.Error())
+		}
+		return entries
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", 5)
+		if len(fields) != 5 {
+			continue
+		}
+		t, _ := time.Parse(time.RFC3339, fields[0])
+		entries = append(entries, AuditEntry{
+			Time:   t,
+			Admin:  fields[1],
+			Action: fields[2],
+			Target: fields[3],
+			Detail: fields[4],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		log.Println("audit:", err.Error())
+	}
+
+	/* newest first */
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	if len(entries) > max {
+		entries = entries[:max]
+	}
+
+	return entries
+}
@@ -1,27 +1,61 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"runtime"
 	"sort"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 )
 
 type Options struct {
-	UpdateFromWeb   bool
-	ScheduleFromWeb bool
-	ScheduleUrl     string
-	UpdateUrl       string
-	PwRecoverSecret string
-	HostWhiteList   string
-	AdminEmail      string
-	AdminEmailPw    string
+	UpdateFromWeb    bool
+	ScheduleFromWeb  bool
+	ScheduleUrl      string
+	ScheduleFormat   string // html, json, csv or ical, see schedule.go
+	TeamFile         string // team registry, see teams.go
+	UpdateUrl        string
+	PwRecoverSecret  string
+	SessionSecret    string
+	HostWhiteList    string
+	AdminEmail       string
+	AdminEmailPw     string
+	MailTransport    string // tls, starttls, plain or file, see mail.go
+	MailHost         string
+	MailPort         int
+	MailSkipVerify   bool   // do not verify the mail server's certificate
+	MailDir          string // where the file transport writes mail
+	OutboxDir        string // queue of mail to send, see outbox.go
+	UserStore        string // xml or bolt, see userstore.go
+	UserStorePath    string
+	UserBackups      int    // old versions of each user file to keep, -1 for none
+	SeasonFile       string // saved schedule and results, see season.go
+	ArchiveDir       string // where the seasonYYYY.xml files are, default the working directory
+	ScheduleRefresh  bool   // get every week from ScheduleUrl at startup
+	Season           int    // year of the current season, 0 to go by the date, see season.go
+	Weeks            int    // weeks in the regular season, 0 to go by the schedule
+	Playoffs         []PlayoffRound
+	PlayoffStandings string         // "separate" (default) or "combined", see season.go
+	LeagueFile       string         // see league.go
+	AuditLog         string         // what the administrators did, see audit.go
+	TieScoring       string         // zero, half or full confidence for a tied game, see picks.go
+	SpreadFile       string         // point spreads for the ats leagues, see spread.go
+	SpreadFreeze     string         // how long before kickoff a spread is frozen, "24h"
+	Tiebreaker       bool           // predict a game's total points, see tiebreaker.go
+	Ledger           LedgerRules    // the pool's entry fees and payouts in cents, leagues set their own, see ledger.go
+	LedgerFile       string         // adjustments entered by the administrators
+	Standings        StandingsRules // dropped weeks and missed weeks, see standings.go
+}
+
+/* A playoff round, a week after the regular season.  Url is
+ * where its schedule comes from, used as is. */
+type PlayoffRound struct {
+	Label string
+	Url   string
 }
 
 type GameStatus int
@@ -32,20 +66,37 @@ const (
 	Finished
 )
 
-const numberOfWeeks = 17
+func (s GameStatus) String() string {
+	switch s {
+	case Future:
+		return "future"
+	case InProgress:
+		return "in progress"
+	case Finished:
+		return "finished"
+	}
+	return "unknown"
+}
 
 type Game struct {
-	TeamV  string
-	TeamH  string
-	ScoreV string
-	ScoreH string
-	Time   string
-	Day    Date
-	Status GameStatus
+	TeamV    string
+	TeamH    string
+	ScoreV   string
+	ScoreH   string
+	Time     string
+	Day      Date
+	Status   GameStatus
+	Override bool    `xml:",omitempty"` // set by an admin, the schedule page does not change it
+	Spread   float64 `xml:",omitempty"` // points given to the home team, see spread.go
 }
 
 type Week struct {
 	Num        int
+	Label      string // name of a playoff round
+	Playoff    bool
+	Tiebreaker string `xml:",omitempty"` // visiting team of the tiebreaker game, "" for the last game
+	Reminded   bool   `xml:",omitempty"` // the pick reminders went out, see weekmail.go
+	Reported   bool   `xml:",omitempty"` // the results went out
 	weekStart  time.Time
 	weekEnd    time.Time
 	Games      []Game
@@ -54,7 +105,7 @@ type Week struct {
 
 type Season struct {
 	Year int
-	Week [numberOfWeeks]Week
+	Week []Week
 }
 
 type Selection struct {
@@ -67,25 +118,45 @@ type UserWeek struct {
 	Num        int `xml:"Week,attr"`
 	Points     int
 	GoodPicks  int
+	Tiebreaker int `xml:",omitempty"` // predicted total points of the tiebreaker game
+	Pushes     int `xml:",omitempty"` // picks that came out even against the spread, see atsWeeks()
 	Selections []Selection
+	Survivor   string `xml:",omitempty"` // the team picked for the survivor leagues, see survivor.go
+}
+
+/* Which kinds of optional email a user wants.
+ * Only looked at when User.Subscribe is set. */
+type EmailPrefs struct {
+	Reminders     bool // picks not made yet for the week
+	WeeklyResults bool // results after the week is over
+	Security      bool // password changed, etc.
 }
 
 type User struct {
-	Email     string
-	Name      string
-	PwHash    string
-	Subscribe bool
-	UserWeeks []UserWeek
-	fileLock  sync.Mutex
+	Email       string
+	Name        string
+	PwHash      string
+	SessionGen  int  // bumped to invalidate all sessions
+	Admin       bool // can use /admin, see admin.go
+	Disabled    bool // can not log in
+	Subscribe   bool
+	EmailPrefs  EmailPrefs
+	Season      int // year of the season UserWeeks is for
+	UserWeeks   []UserWeek
+	PastSeasons []UserSeason // newest first, read only
+	fileLock    sync.Mutex
 }
 
 type StandingRow struct {
-	Name        string
-	Total       int
-	WeeksPlayed int
-	WeeksWon    int
-	AvePerWeek  string
-	GoodPicks   int
+	Name        string `json:"name"`
+	Total       int    `json:"total"`
+	RawTotal    int    `json:"rawTotal"` // the points before options.Standings, see standings.go
+	WeeksPlayed int    `json:"weeksPlayed"`
+	WeeksWon    int    `json:"weeksWon"`
+	AvePerWeek  string `json:"avePerWeek"`
+	GoodPicks   int    `json:"goodPicks"`
+	Pushes      int    `json:"pushes,omitempty"`
+	email       string
 }
 
 /* For sorting the standings, note we want
@@ -100,128 +171,6 @@ func (a ByStandingRow) Less(i, j int) bool { return a[i].Total > a[j].Total }
 
 var options Options
 
-var season = Season{Year: 2020}
-
-// will be indexed by user name
-var users map[string]*User
-
-var toTeam map[string]string
-
-var toLogo map[string]string
-
-/* Current index into season.Week[] */
-var iWeek int
-
-var seasonEnded bool
-
-/**********************************************************/
-
-func init() {
-	toTeam = map[string]string{
-		"Arizona":              "Cardinals",
-		"Arizona Cardinals":    "Cardinals",
-		"Atlanta":              "Falcons",
-		"Atlanta Falcons":      "Falcons",
-		"Baltimore":            "Ravens",
-		"Baltimore Ravens":     "Ravens",
-		"Buffalo":              "Bills",
-		"Buffalo Bills":        "Bills",
-		"Carolina":             "Panthers",
-		"Carolina Panthers":    "Panthers",
-		"Chicago":              "Bears",
-		"Chicago Bears":        "Bears",
-		"Cincinnati":           "Bengals",
-		"Cincinnati Bengals":   "Bengals",
-		"Cleveland":            "Browns",
-		"Cleveland Browns":     "Browns",
-		"Dallas":               "Cowboys",
-		"Dallas Cowboys":       "Cowboys",
-		"Denver":               "Broncos",
-		"Denver Broncos":       "Broncos",
-		"Detroit":              "Lions",
-		"Detroit Lions":        "Lions",
-		"Green Bay":            "Packers",
-		"Green Bay Packers":    "Packers",
-		"Houston":              "Texans",
-		"Houston Texans":       "Texans",
-		"Indianapolis":         "Colts",
-		"Indianapolis Colts":   "Colts",
-		"Jacksonville":         "Jaguars",
-		"Jacksonville Jaguars": "Jaguars",
-		"Kansas City":          "Chiefs",
-		"Kansas City Chiefs":   "Chiefs",
-		"LA Chargers":          "Chargers",
-		"Los Angeles Chargers": "Chargers",
-		"LA Rams":              "Rams",
-		"Los Angeles Rams":     "Rams",
-		"Las Vegas":            "Raiders",
-		"Las Vegas Raiders":    "Raiders",
-		"Miami":                "Dolphins",
-		"Miami Dolphins":       "Dolphins",
-		"Minnesota":            "Vikings",
-		"Minnesota Vikings":    "Vikings",
-		"New England":          "Patriots",
-		"New England Patriots": "Patriots",
-		"New Orleans":          "Saints",
-		"New Orleans Saints":   "Saints",
-		"NY Giants":            "Giants",
-		"New York Giants":      "Giants",
-		"NY Jets":              "Jets",
-		"New York Jets":        "Jets",
-		"Philadelphia":         "Eagles",
-		"Philadelphia Eagles":  "Eagles",
-		"Pittsburgh":           "Steelers",
-		"Pittsburgh Steelers":  "Steelers",
-		"San Diego":            "Chargers",
-		"San Diego Chargers":   "Chargers",
-		"San Francisco":        "49ers",
-		"San Francisco 49ers":  "49ers",
-		"Seattle":              "Seahawks",
-		"Seattle Seahawks":     "Seahawks",
-		"Tampa Bay":            "Buccaneers",
-		"Tampa Bay Buccaneers": "Buccaneers",
-		"Tennessee":            "Titans",
-		"Tennessee Titans":     "Titans",
-		"Washington":           "Redskins",
-		"Washington Redskins":  "Redskins",
-	}
-
-	toLogo = map[string]string{
-		"Cardinals":  "ARI.svg",
-		"Falcons":    "ATL.svg",
-		"Ravens":     "BAL.svg",
-		"Bills":      "BUF.svg",
-		"Panthers":   "CAR.svg",
-		"Bears":      "CHI.svg",
-		"Bengals":    "CIN.svg",
-		"Browns":     "CLE.svg",
-		"Cowboys":    "DAL.svg",
-		"Broncos":    "DEN.svg",
-		"Lions":      "DET.svg",
-		"Packers":    "GB.svg",
-		"Texans":     "HOU.svg",
-		"Colts":      "IND.svg",
-		"Jaguars":    "JAX.svg",
-		"Chiefs":     "KC.svg",
-		"Chargers":   "LAC.svg",
-		"Rams":       "LA.svg",
-		"Dolphins":   "MIA.svg",
-		"Vikings":    "MIN.svg",
-		"Patriots":   "NE.svg",
-		"Saints":     "NO.svg",
-		"Giants":     "NYG.svg",
-		"Jets":       "NYJ.svg",
-		"Raiders":    "OAK.svg",
-		"Eagles":     "PHI.svg",
-		"Steelers":   "PIT.svg",
-		"49ers":      "SF.svg",
-		"Seahawks":   "SEA.svg",
-		"Buccaneers": "TB.svg",
-		"Titans":     "TEN.svg",
-		"Redskins":   "WAS.svg",
-	}
-}
-
 /**********************************************************/
 
 type GameStartError struct {
@@ -237,38 +186,58 @@ func (e GameStartError) Error() string {
 
 func updateWeekIndex() {
 	/* where are we in the schedule?
-	 * Update global variable iWeek */
+	 * Update store.iWeek, caller must hold the store lock */
 	var t time.Time
 
-	iWeek = -1
+	store.iWeek = -1
+	store.seasonEnded = false
 
 	t = time.Now()
 	log.Println("What week are we in? current time:", t)
-	for i, _ := range season.Week {
+	for i, _ := range store.season.Week {
+		if len(store.season.Week[i].Games) == 0 {
+			if store.season.Week[i].Playoff {
+				/* the round is not scheduled yet,
+				 * updateGames() will get it */
+				log.Println("Waiting for", store.season.Week[i].name())
+				store.iWeek = i
+				break
+			}
+			continue
+		}
+
 		/* endWeek is the start time of the last game,
 		 * so consider the end of the week 24 hours later */
-		weekEndTime := season.Week[i].weekEnd.Add(24 * time.Hour)
-		log.Println("week", season.Week[i].Num, "start", season.Week[i].weekStart, "end+24", weekEndTime)
-		if t.After(season.Week[i].weekStart) && t.Before(weekEndTime) {
-			log.Println("In week", season.Week[i].Num)
-			iWeek = i
+		weekEndTime := store.season.Week[i].weekEnd.Add(24 * time.Hour)
+		log.Println("week", store.season.Week[i].Num, "start", store.season.Week[i].weekStart, "end+24", weekEndTime)
+		if t.After(store.season.Week[i].weekStart) && t.Before(weekEndTime) {
+			log.Println("In week", store.season.Week[i].Num)
+			store.iWeek = i
 			break
 		}
-		if t.Before(season.Week[i].weekStart) {
-			log.Println("Before week", season.Week[i].Num)
-			iWeek = i
+		if t.Before(store.season.Week[i].weekStart) {
+			log.Println("Before week", store.season.Week[i].Num)
+			store.iWeek = i
 			break
 		}
 	}
 
-	/* are we at the end of the season? */
-	weekEndTime := season.Week[len(season.Week)-1].weekEnd.Add(24 * time.Hour)
-	if t.After(weekEndTime) {
-		iWeek = len(season.Week) - 1
-		seasonEnded = true
+	/* are we at the end of the season?  Weeks the schedule
+	 * could not give us yet, see fillEmptyWeeks(), do not count */
+	for i := len(store.season.Week) - 1; store.iWeek == -1 && i >= 0; i-- {
+		lastWeek := &store.season.Week[i]
+		if len(lastWeek.Games) == 0 {
+			continue
+		}
+		weekEndTime := lastWeek.weekEnd.Add(24 * time.Hour)
+		if t.After(weekEndTime) {
+			store.iWeek = i
+			store.seasonEnded = true
+		}
+		break
 	}
 
-	if iWeek == -1 {
+	if store.iWeek == -1 {
 		log.Println("Could not calculate iWeek")
 		panic("Could not calculate iWeek")
 	}
@@ -276,39 +245,141 @@ func updateWeekIndex() {
 
 /**********************************************************/
 
+/* Caller must hold the store lock, at least for reading.  The
+ * standings anybody can see, the players in no league. */
 func getStandings() []StandingRow {
+	return seasonStandings(store.season.Year, defaultLeague(nil))
+}
+
+/* Caller must hold the store lock, at least for reading.  The
+ * standings for the current season or one in the archive, for the
+ * league's members or with no league for everybody. */
+func seasonStandings(year int, league *League) []StandingRow {
+	return standingsFor(year, false, league)
+}
+
+/* Caller must hold the store lock, at least for reading.  The
+ * playoff leaderboard, nil if the playoffs count in the standings
+ * or have not started. */
+func playoffStandings(year int, league *League) []StandingRow {
+	season := seasonFor(year)
+	if season == nil {
+		return nil
+	}
+
+	lastIWeek := standingsWeeks(season)
+	for i := 0; i < lastIWeek; i++ {
+		if countsInStandings(&season.Week[i], true, league) {
+			return standingsFor(year, true, league)
+		}
+	}
+
+	return nil
+}
+
+/* Whether the week counts in the playoff leaderboard, or if not
+ * playoffBoard, in the main standings */
+func countsInStandings(w *Week, playoffBoard bool, league *League) bool {
+	if league.playoffMode() == "combined" {
+		return !playoffBoard
+	}
+	return w.Playoff == playoffBoard
+}
+
+/* Caller must hold the store lock, at least for reading.
+ * How many weeks of the season are in the standings. */
+func standingsWeeks(season *Season) int {
 	/* note that we are not going up to the current week,
 	 * unless the seaon is over */
-	lastIWeek := iWeek
-	if seasonEnded {
-		lastIWeek++
+	if season != &store.season {
+		return len(season.Week)
+	}
+	if store.seasonEnded {
+		return store.iWeek + 1
 	}
+	return store.iWeek
+}
 
-	highScore := make([]int, lastIWeek)
-	standings := make([]StandingRow, 0)
+/* Caller must hold the store lock, at least for reading */
+func standingsFor(year int, playoffBoard bool, league *League) []StandingRow {
+	season := seasonFor(year)
+	if season == nil {
+		return make([]StandingRow, 0)
+	}
 
-	for _, u := range users {
-		for i := 0; i < lastIWeek; i++ {
-			if u.UserWeeks[i].Points > highScore[i] {
-				highScore[i] = u.UserWeeks[i].Points
+	lastIWeek := standingsWeeks(season)
+
+	/* the weeks as the league scores them */
+	userWeeks := make(map[*User][]UserWeek)
+	for _, u := range store.users {
+		if league.includes(u) {
+			userWeeks[u] = league.weeks(u, year)
+		}
+	}
+
+	/* who won each week, the high score with the tiebreaker,
+	 * and the low score for the weeks players missed */
+	won := make(map[*UserWeek]bool)
+	lowest := make(map[int]int)
+	for i := 0; i < lastIWeek; i++ {
+		if !countsInStandings(&season.Week[i], playoffBoard, league) {
+			continue
+		}
+		weekly := make([]*UserWeek, 0, len(store.users))
+		for _, u := range store.users {
+			weeks := userWeeks[u]
+			if i < len(weeks) {
+				weekly = append(weekly, &weeks[i])
+			}
+		}
+		for j, winner := range weekWinners(&season.Week[i], weekly) {
+			if winner {
+				won[weekly[j]] = true
+			}
+			if _, ok := lowest[i]; weekly[j].Selections != nil && (!ok || weekly[j].Points < lowest[i]) {
+				lowest[i] = weekly[j].Points
 			}
 		}
 	}
+	adjusted := !playoffBoard && standingsAdjusted()
+
+	standings := make([]StandingRow, 0)
+
+	for _, u := range store.users {
+		weeks := userWeeks[u]
+		if weeks == nil {
+			/* did not play that season, or not in the league */
+			continue
+		}
 
-	for _, u := range users {
 		weeksWon := 0
 		goodPicks := 0
+		pushes := 0
 		weeksPlayed := 0
 		totalForUser := 0
 		aveScoreStr := "0.0"
+		points := make([]int, 0, lastIWeek)
 
 		for i := 0; i < lastIWeek; i++ {
-			goodPicks += u.UserWeeks[i].GoodPicks
-			totalForUser += u.UserWeeks[i].Points
-			if u.UserWeeks[i].Points == highScore[i] {
+			if !countsInStandings(&season.Week[i], playoffBoard, league) {
+				continue
+			}
+			if i >= len(weeks) || weeks[i].Selections == nil {
+				points = append(points, missedWeekPoints(lowest[i]))
+			}
+			if i >= len(weeks) {
+				continue
+			}
+			if weeks[i].Selections != nil {
+				points = append(points, weeks[i].Points)
+			}
+			goodPicks += weeks[i].GoodPicks
+			pushes += weeks[i].Pushes
+			totalForUser += weeks[i].Points
+			if won[&weeks[i]] {
 				weeksWon++
 			}
-			if u.UserWeeks[i].Selections != nil {
+			if weeks[i].Selections != nil {
 				weeksPlayed++
 			}
 		}
@@ -318,13 +389,21 @@ func getStandings() []StandingRow {
 			aveScoreStr = strconv.FormatFloat(aveScore, 'f', 1, 32)
 		}
 
+		total := totalForUser
+		if adjusted {
+			total = adjustedTotal(points)
+		}
+
 		x := StandingRow{
 			Name:        u.Name,
-			Total:       totalForUser,
+			Total:       total,
+			RawTotal:    totalForUser,
 			WeeksPlayed: weeksPlayed,
 			WeeksWon:    weeksWon,
 			AvePerWeek:  aveScoreStr,
 			GoodPicks:   goodPicks,
+			Pushes:      pushes,
+			email:       u.Email,
 		}
 		standings = append(standings, x)
 	}
@@ -341,11 +420,11 @@ func beforeIWeek(date Date) bool {
 	t := date.Time()
 	t = t.Add(6 * time.Hour) // so that the day in California is the same as New York
 
-	iWeekDay := season.Week[iWeek].weekStart.YearDay()
+	iWeekDay := store.season.Week[store.iWeek].weekStart.YearDay()
 	day := t.YearDay()
 
-	if t.Year() < season.Week[iWeek].weekStart.Year() {
-		log.Println("beforeIWeek returning true, year", t.Year(), "<", season.Week[iWeek].weekStart.Year())
+	if t.Year() < store.season.Week[store.iWeek].weekStart.Year() {
+		log.Println("beforeIWeek returning true, year", t.Year(), "<", store.season.Week[store.iWeek].weekStart.Year())
 		return true
 	}
 
@@ -359,42 +438,70 @@ func beforeIWeek(date Date) bool {
 
 /**********************************************************/
 
+/* Tries again to get the regular weeks that have no games, the
+ * schedule could not be read for them at startup.  The week index
+ * is worked out again for each week that gets its games. */
+func fillEmptyWeeks() {
+	store.RLock()
+	year := store.season.Year
+	urls := make(map[int]string)
+	for iw := range store.season.Week {
+		if len(store.season.Week[iw].Games) == 0 && !store.season.Week[iw].Playoff {
+			urls[iw] = weekUrl(iw, options.UpdateFromWeb)
+		}
+	}
+	store.RUnlock()
+
+	for iw, url := range urls {
+		games, err := readSchedule(url, options.UpdateFromWeb, year)
+		if err != nil {
+			log.Println("Still cannot read", url, ":", err.Error())
+			continue
+		}
+		if len(games) == 0 {
+			continue
+		}
+
+		updateWeekGames(iw, games)
+		store.Lock()
+		updateWeekIndex()
+		store.Unlock()
+	}
+}
+
+/**********************************************************/
+
 func updateGames() {
 	for {
-		fmt.Println("updating games for week indx", iWeek, " @", time.Now())
+		fillEmptyWeeks()
+
+		store.RLock()
+		iw := store.iWeek
+		url := weekUrl(iw, options.UpdateFromWeb)
+		year := store.season.Year
+		store.RUnlock()
+
+		fmt.Println("updating games for week indx", iw, " @", time.Now())
 
 		gamesInProgress := false
 		gameTimes := make(map[int64]bool)
 
-		iter := gameSchPageIterator{}
-
-		var err error
-		var file *os.File
-		var resp *http.Response
-		if options.UpdateFromWeb {
-			url := fmt.Sprintf("%s%d", options.ScheduleUrl, iWeek+1)
-			log.Println("Updating games for week indx", iWeek, "from", url, ":")
-			resp, err = http.Get(url)
-			for err != nil {
-				log.Println("Error from http.Get, retry in 1 minute:", err.Error())
-				time.Sleep(1 * time.Minute)
-				resp, err = http.Get(url)
-			}
-			iter.p.Init(resp.Body)
-		} else {
-			fileName := fmt.Sprintf("%s%d.html", options.ScheduleUrl, iWeek+1)
-			log.Println("Updating games for week indx", iWeek, "from", fileName, ":")
-			file, err = os.Open(fileName) // For read access.
-			if err != nil {
-				log.Println("cannot open ", fileName)
-				return
-			}
-			iter.p.Init(file)
+		log.Println("Updating games for week indx", iw, "from", url, ":")
+		games, err := readSchedule(url, options.UpdateFromWeb, year)
+		if err != nil {
+			/* the page is down, a playoff round's file is not
+			 * there yet or has a team we do not know.  Keep
+			 * trying, the later weeks still need their scores. */
+			log.Println("Error reading schedule", url, "retry in 1 minute:", err.Error())
+			time.Sleep(1 * time.Minute)
+
+			store.Lock()
+			updateWeekIndex()
+			store.Unlock()
+			continue
 		}
 
-		for iter.Next() {
-			game := iter.game
-
+		for _, game := range games {
 			switch game.Status {
 			case Future:
 				t := game.Day.AddDayTime(game.Time)
@@ -407,27 +514,9 @@ func updateGames() {
 				gamesInProgress = true
 			case Finished:
 			}
-
-			pGame := season.Week[iWeek].teamToGame[game.TeamV]
-			if pGame == nil {
-				_, _, line, _ := runtime.Caller(0)
-				fmt.Println("line", line, "Could not find game for team", game.TeamV)
-				log.Println("line", line, "Could not find game for team", game.TeamV)
-				continue
-			}
-
-			// Update the game in season.Week[iWeek].Games[]
-			*pGame = game
-		}
-
-		/* Done with parsing the page, a little cleanup */
-		if options.UpdateFromWeb {
-			resp.Body.Close()
-		} else {
-			file.Close()
 		}
 
-		updateUserScoresWeekIndex(iWeek)
+		updateWeekGames(iw, games)
 
 		/* Compute the next time to loop */
 
@@ -490,67 +579,88 @@ func updateGames() {
 
 		time.Sleep(sleep)
 
+		store.Lock()
 		updateWeekIndex()
+		store.Unlock()
+	}
+}
+
+/* Stores the games from the schedule page in the season
+ * and updates the scores of the users */
+func updateWeekGames(iw int, games []Game) {
+	store.Lock()
+	defer store.Unlock()
+
+	week := &store.season.Week[iw]
+	if len(week.Games) == 0 && len(games) > 0 {
+		/* the first games for the week, a playoff round
+		 * that was not scheduled at startup */
+		log.Println("Got", len(games), "games for", week.name())
+		week.Games = games
+		week.index()
+		games = nil
+	}
+
+	for _, game := range games {
+		pGame := week.teamToGame[game.TeamV]
+		if pGame == nil {
+			_, _, line, _ := runtime.Caller(0)
+			fmt.Println("line", line, "Could not find game for team", game.TeamV)
+			log.Println("line", line, "Could not find game for team", game.TeamV)
+			continue
+		}
+
+		if pGame.Override {
+			log.Println("Not updating", pGame.TeamV, "at", pGame.TeamH, "the result was set by an admin")
+			continue
+		}
+
+		// Update the game in store.season.Week[iw].Games[]
+		game.Spread = pGame.Spread
+		*pGame = game
+	}
+	loadSpreads()
+
+	if err := saveSeason(); err != nil {
+		log.Println("Could not save season:", err.Error())
+	}
+
+	updateUserScoresWeekIndex(iw)
+
+	if sendWeekMail(time.Now()) {
+		if err := saveSeason(); err != nil {
+			log.Println("Could not save season:", err.Error())
+		}
 	}
 }
 
 /*****************************************************************************/
 
+/* Caller must hold the store lock */
 func updateUserScoresWeekIndex(iw int) {
 	log.Println("Updating user scores for week indx", iw)
 
-	for _, u := range users {
+	for _, u := range store.users {
 		log.Println("---User", u.Email, "---")
 		goodPicks := 0
 		totalPoints := 0
 		for _, s := range u.UserWeeks[iw].Selections {
-			game := season.Week[iw].teamToGame[s.Team]
+			game := store.season.Week[iw].teamToGame[s.Team]
 			if game == nil {
 				_, _, line, _ := runtime.Caller(0)
 				fmt.Println("line", line, "iWeek", iw, "Could not find game for user", u.Email, "selection", s.Team)
 				log.Println("line", line, "iWeek", iw, "Could not find game for user", u.Email, "selection", s.Team)
 				continue
 			}
-			if game.Status == InProgress || game.Status == Finished {
-				/* the game has started or finished */
-
-				/* get current score */
-				scoreV, err := strconv.Atoi(game.ScoreV)
-				if err != nil {
-					continue
-				}
-				scoreH, err := strconv.Atoi(game.ScoreH)
-				if err != nil {
-					continue
-				}
-
-				/* team1 verb team1 user %d points */
-				points := 0
-				verb := "even with"
-				team1 := game.TeamH
-				team2 := game.TeamV
-				if scoreH != scoreV {
-					verb = "leads"
-				}
-				if scoreH > scoreV {
-					if s.Team == game.TeamH {
-						points = s.Confidence
-					}
-				}
-				if scoreH < scoreV {
-					team1 = game.TeamV
-					team2 = game.TeamH
-					if s.Team == game.TeamV {
-						points = s.Confidence
-					}
-				}
-
-				totalPoints += points
-				if points > 0 {
+			/* the game has started or finished */
+			if score, ok := scorePick(game, s, false); ok {
+				totalPoints += score.Points
+				if score.Good {
 					goodPicks++
 				}
 
-				log.Printf("\t%s %s %s user %s %d points\n", team1, verb, team2, u.Email, points)
+				log.Printf("\t%s at %s %s-%s winner %s user %s %d points\n",
+					game.TeamV, game.TeamH, game.ScoreV, game.ScoreH, score.Winner, u.Email, score.Points)
 			}
 		}
 
@@ -568,7 +678,7 @@ func updateUserScoresWeekIndex(iw int) {
 /*****************************************************************************/
 
 func updateUserScores() {
-	for iw, _ := range season.Week {
+	for iw, _ := range store.season.Week {
 		updateUserScoresWeekIndex(iw)
 	}
 }
@@ -584,209 +694,278 @@ func (a ByInt64) Less(i, j int) bool { return a[i] < a[j] }
 
 /*****************************************************************************/
 
-type gameSchPageIterator struct {
-	p      ParseHTML
-	game   Game
-	dayStr string
-}
+/* Gets the games for store.season.Week[week] from url.  If the
+ * schedule can not be read the week is left as it was. */
+func getSchedule(week int, url string) error {
+
+	allGamesFinal := true
+	gamesInProgress := false
 
-func (iter *gameSchPageIterator) Next() bool {
-	var timeStr string
-	var teamHStr string
-	var teamVStr string
-	var scoreVStr string
-	var scoreHStr string
-	var b bool
+	log.Println("Getting games for week indx", week, "from", url, ":")
 
-	if iter.p.SeekTag("divider", "left") == false {
-		return false
+	games, err := readSchedule(url, options.ScheduleFromWeb, store.season.Year)
+	if err != nil {
+		log.Println("cannot read", url, ":", err.Error())
+		return err
 	}
 
-	if strings.Compare("divider", iter.p.Tok.Attr[0].Val) == 0 {
-		// section for games on this day
-		iter.dayStr = iter.p.GetText()
-
-		// advances to game date which will be same as iter.dayStr
-		iter.p.SeekTag("left")
+	for _, game := range games {
+		switch game.Status {
+		case Future:
+			allGamesFinal = false
+		case InProgress:
+			allGamesFinal = false
+			gamesInProgress = true
+		case Finished:
+		}
 	}
 
-	iter.p.SeekTag("center", "right")
+	if len(games) == 0 {
+		log.Println("No games found for week indx", week, "in", url)
+		return fmt.Errorf("no games found in %s: %w", url, errNoSchedule)
+	}
 
-	if strings.Compare("right", iter.p.Tok.Attr[0].Val) == 0 {
-		// Game time
-		timeStr = iter.p.GetText()
-	} else {
-		// center tag.
-		// <th class="center" style="width:10%;">FINAL</th></tr>
-		timeStr = iter.p.GetText()
+	/* keep the results an admin set and the spreads */
+	for i := range games {
+		old := store.season.Week[week].teamToGame[games[i].TeamV]
+		if old == nil {
+			continue
+		}
+		if old.Override {
+			log.Println("Keeping", old.TeamV, "at", old.TeamH, "the result was set by an admin")
+			games[i] = *old
+		}
+		games[i].Spread = old.Spread
 	}
 
-	scoreVStr = ""
-	scoreHStr = ""
+	store.season.Week[week].Games = games
+	store.season.Week[week].index()
 
-	iter.p.SeekTag("left")
-	teamVStr = toTeam[iter.p.GetText()]
+	log.Println("Week Index", week, "Num", store.season.Week[week].Num,
+		"start", store.season.Week[week].weekStart.Format("Mon Jan 2"),
+		"end", store.season.Week[week].weekEnd.Format("Mon Jan 2"))
+	log.Println("Games in progress = ", gamesInProgress)
+	log.Println("All Games Final = ", allGamesFinal)
 
-	if strings.Contains(timeStr, "FINAL") || strings.Contains(timeStr, "F/OT") {
-		scoreVStr, b = iter.p.SeekBoldText()
-		if !b {
-			fmt.Println("SeekBoldText() failed after teamVStr", teamVStr)
-			return false
-		}
-	}
+	return nil
+}
 
-	iter.p.SeekTag("left")
-	teamHStr = toTeam[iter.p.GetText()]
+/**********************************************************/
 
-	if strings.Contains(timeStr, "FINAL") || strings.Contains(timeStr, "F/OT") {
-		scoreHStr, b = iter.p.SeekBoldText()
-		if !b {
-			fmt.Println("SeekBoldText() failed after teamHStr", teamHStr)
-			return false
-		}
+/* Gets the season's schedule at startup: the schedule and results
+ * we saved last time, and from ScheduleUrl the weeks we do not have.
+ * Returns whether the season's length was probed from ScheduleUrl,
+ * and an error if no week has any games, as when ScheduleUrl is down
+ * and there is no saved season.  Nothing else is running yet, so
+ * the store is not locked. */
+func loadSchedule() (bool, error) {
+	err := loadSeason()
+	if err != nil {
+		fmt.Println("Could not load saved season:", err.Error())
+		log.Println("Could not load saved season:", err.Error())
 	}
 
-	log.Println(teamVStr, scoreVStr, "vs", teamHStr, scoreHStr, "on", iter.dayStr, " ", timeStr)
+	/* How long the regular season is: options.Weeks, or what we
+	 * saved last time, or as many weeks as ScheduleUrl has games
+	 * for.  The playoff rounds come after it. */
+	regular := options.Weeks
+	if regular == 0 {
+		regular = store.season.regularWeeks()
+	}
+	probed := regular == 0
+	probe := probed
+	if probe {
+		regular = maxScheduleWeeks
+	}
+	store.season.layout(regular, options.Playoffs)
+
+	/* only a week that is not there ends the probe, a week we
+	 * could not read leaves us unsure of the season's length */
+	unsure := false
+	for week := 0; week < len(store.season.Week); week++ {
+		if len(store.season.Week[week].Games) > 0 && !options.ScheduleRefresh {
+			continue
+		}
 
-	var day Date
-	day.Set(iter.dayStr)
+		s := weekUrl(week, options.ScheduleFromWeb)
+		if err := getSchedule(week, s); err != nil {
+			if probe && !store.season.Week[week].Playoff {
+				if errors.Is(err, errNoSchedule) {
+					log.Println("No schedule for week", week+1, "so the regular season has", week, "weeks")
+					store.season.layout(week, options.Playoffs)
+					probe = false
+					week-- /* the first playoff round is at this index now */
+					continue
+				}
+				unsure = true
+			}
+			fmt.Println("Could not get schedule for week", week+1, ":", err.Error())
+			continue
+		}
+		log.Println("Scheule for week", week, ":", store.season.Week[week])
+		fmt.Println(store.season.Week[week])
+		fmt.Println()
+	}
 
-	var gameStatus GameStatus
-	switch {
-	case strings.Contains(timeStr, "FINAL") || strings.Contains(timeStr, "F/OT"):
-		gameStatus = Finished
-	case strings.Contains(timeStr, "AM") || strings.Contains(timeStr, "PM"):
-		gameStatus = Future
-	default:
-		gameStatus = InProgress
+	/* there is no week to start in */
+	if !store.season.scheduled() {
+		return probed, fmt.Errorf("no schedule for season %d", store.season.Year)
 	}
 
-	iter.game = Game{
-		TeamV:  teamVStr,
-		TeamH:  teamHStr,
-		ScoreV: scoreVStr,
-		ScoreH: scoreHStr,
-		Day:    day,
-		Time:   timeStr,
-		Status: gameStatus,
+	loadSpreads()
+
+	/* a saved season sets the length the next time, so do not
+	 * save one we only guessed at */
+	if unsure {
+		fmt.Println("Some weeks could not be read, not saving the season's length")
+		log.Println("Some weeks could not be read, not saving the season's length")
+	} else if err := saveSeason(); err != nil {
+		fmt.Println("Could not save season:", err.Error())
+		log.Println("Could not save season:", err.Error())
 	}
 
-	return true
+	return probed, nil
 }
 
-/*****************************************************************************/
+/**********************************************************/
 
-func getSchedule(week int, url string) {
+func main() {
 
-	allGamesFinal := true
-	gamesInProgress := false
-	gameTimes := make(map[int64]bool)
+	options = optionsFromFile()
+
+	/* setup logging */
+	/* TODO: append to log file */
+	logFile, err := os.Create("fbScores.log")
+	if err != nil {
+		log.Println("cannot open fbScores.log")
+		return
+	}
+	log.SetFlags(log.LstdFlags)
+	log.SetOutput(logFile)
 
-	season.Week[week].Games = make([]Game, 0, 16)
-	season.Week[week].teamToGame = make(map[string]*Game)
+	log.Println("Program started")
 
-	log.Println("Getting games for week indx", week, "from", url, ":")
+	log.Println("Options", options)
 
-	iter := gameSchPageIterator{}
+	userStore, err = openUserStore(optionsUserStoreSpec(options))
+	if err != nil {
+		fmt.Println("user store:", err.Error())
+		log.Println("user store:", err.Error())
+		return
+	}
+	defer userStore.Close()
 
-	if options.ScheduleFromWeb {
-		resp, err := http.Get(url)
+	if migrateUsersTo != "" {
+		to, err := openUserStore(migrateUsersTo)
 		if err != nil {
-			log.Println("Error from http.Get:", err.Error())
+			fmt.Println("user store:", err.Error())
 			return
 		}
-		defer resp.Body.Close()
-		iter.p.Init(resp.Body)
-	} else {
-		fileName := url
-		file, err := os.Open(fileName) // For read access.
+		n, err := migrateUsers(userStore, to)
+		to.Close()
 		if err != nil {
-			log.Println("cannot open ", fileName)
+			fmt.Println("migrating users:", err.Error())
 			return
 		}
-		defer file.Close()
-		iter.p.Init(file)
+		fmt.Println("copied", n, "users to", migrateUsersTo)
+		return
 	}
 
-	for iter.Next() {
-		game := iter.game
-		switch game.Status {
-		case Future:
-			allGamesFinal = false
-		case InProgress:
-			allGamesFinal = false
-			gamesInProgress = true
-		case Finished:
-		}
-
-		/* Convenient way to store dates of games without duplicates */
-		gameTimes[game.Day.Time().Unix()] = true
+	initSessions()
 
-		season.Week[week].Games = append(season.Week[week].Games, game)
-		gameIndex := len(season.Week[week].Games) - 1
-		season.Week[week].teamToGame[game.TeamV] = &season.Week[week].Games[gameIndex]
-		season.Week[week].teamToGame[game.TeamH] = &season.Week[week].Games[gameIndex]
+	mailer, err = newMailer(options)
+	if err != nil {
+		fmt.Println("mail options:", err.Error())
+		log.Println("mail options:", err.Error())
+		return
 	}
 
-	/* Sort the start times by storing the keys (aka start times)
-	 * in a slice in sorted order */
-	var keys []int64
-	for k := range gameTimes {
-		keys = append(keys, k)
+	err = initOutbox()
+	if err != nil {
+		fmt.Println("outbox:", err.Error())
+		log.Println("outbox:", err.Error())
+		return
 	}
-	sort.Sort(ByInt64(keys))
-
-	// Print the game times (w/o duplicates) in sorted order
-	//    for _, k := range keys {
-	//        fmt.Println("gameTimes ==>", time.Unix(k, 0))
-	//    }
-	season.Week[week].weekStart = time.Unix(keys[0], 0)
-	season.Week[week].weekEnd = time.Unix(keys[len(keys)-1], 0)
-	log.Println("Week Index", week, "Num", season.Week[week].Num,
-		"start", season.Week[week].weekStart.Format("Mon Jan 2"),
-		"end", season.Week[week].weekEnd.Format("Mon Jan 2"))
-	log.Println("Games in progress = ", gamesInProgress)
-	log.Println("All Games Final = ", allGamesFinal)
-}
+	go outboxWorker()
 
-/**********************************************************/
+	scheduleSource, err = newScheduleSource(options)
+	if err != nil {
+		fmt.Println("schedule options:", err.Error())
+		log.Println("schedule options:", err.Error())
+		return
+	}
 
-func main() {
+	if err := checkPoolOptions(options); err != nil {
+		fmt.Println("scoring options:", err.Error())
+		log.Println("scoring options:", err.Error())
+		return
+	}
 
-	options = optionsFromFile()
+	/* Nothing else is running yet, so no need
+	 * to lock the store until go updateGames().
+	 * Users are moved to the current season now and their
+	 * weeks fitted to the schedule once we have it. */
+	if options.Season != 0 {
+		store.season.Year = options.Season
+	} else {
+		store.season.Year = nflSeason(time.Now())
+	}
+	fmt.Println("Season", store.season.Year)
 
-	/* setup logging */
-	/* TODO: append to log file */
-	logFile, err := os.Create("fbScores.log")
+	teamFile := options.TeamFile
+	if teamFile == "" {
+		teamFile = "teams.json"
+	}
+	teams, err = loadTeams(teamFile)
 	if err != nil {
-		log.Println("cannot open fbScores.log")
+		fmt.Println("Could not load teams:", err.Error())
+		log.Println("Could not load teams:", err.Error())
 		return
 	}
-	log.SetFlags(log.LstdFlags)
-	log.SetOutput(logFile)
 
-	log.Println("Program started")
+	getUsers()
+	for _, u := range store.users {
+		resolved := u.resolveTeams()
+		if u.startSeason(store.season.Year) || resolved {
+			writeUserFile(u)
+		}
+	}
 
-	log.Println("Options", options)
+	if err := loadLeagues(); err != nil {
+		fmt.Println("Could not load leagues:", err.Error())
+		log.Println("Could not load leagues:", err.Error())
+		return
+	}
 
-	getUsers()
+	if err := loadLedger(); err != nil {
+		fmt.Println("Could not load ledger:", err.Error())
+		log.Println("Could not load ledger:", err.Error())
+		return
+	}
 
-	fmt.Println("Season", season.Year)
+	probed, err := loadSchedule()
+	if err != nil {
+		fmt.Println("Could not load schedule:", err.Error())
+		log.Println("Could not load schedule:", err.Error())
+		return
+	}
+	fmt.Println("Season", store.season.Year, "has", len(store.season.Week), "weeks")
 
-	for week := 0; week < numberOfWeeks; week++ {
-		var s string
-		if options.ScheduleFromWeb {
-			s = fmt.Sprintf("%s%d", options.ScheduleUrl, week+1)
+	/* a probed season may be cut short, so it only adds weeks */
+	for _, u := range store.users {
+		changed := false
+		if probed {
+			changed = u.growWeeks(len(store.season.Week))
 		} else {
-			s = fmt.Sprintf("%s%d.html", options.ScheduleUrl, week+1)
+			changed = u.fitWeeks(len(store.season.Week))
+		}
+		if changed {
+			writeUserFile(u)
 		}
-		season.Week[week].Num = week + 1
-		getSchedule(week, s)
-		log.Println("Scheule for week", week, ":", season.Week[week])
-		fmt.Println(season.Week[week])
-		fmt.Println()
 	}
 
+	loadArchive()
+
 	updateWeekIndex()
 
 	updateUserScores()
@@ -0,0 +1,305 @@
+package main
+
+/* Leagues, separate pools in one server.
+ *
+ * A league is a group of users with its own standings and settings.
+ * A user makes one set of picks a week and they count in every
+ * league the user is in; a league's standings only look at its
+ * members.  Anybody can start a league and is its owner.  The owner
+ * gives the league's join code to the people who should be in it.
+ * Pages for a league take ?league=<id>, without one they are for the
+ * players the user shares a league with, see defaultLeague().  When
+ * there are no leagues everybody is in the one pool.
+ *
+ * The leagues are saved to options.LeagueFile (default leagues.xml)
+ * every time they change. */
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+/* Settings a league can have different from the options */
+type LeagueSettings struct {
+	PlayoffStandings string      // "separate" or "combined", "" for options.PlayoffStandings
+	PoolMode         string      // "survivor" or "ats", see survivor.go and spread.go, "" for confidence
+	Ledger           LedgerRules // the league's fees and payouts in cents, see ledger.go
+}
+
+type League struct {
+	ID       string `xml:"ID,attr"`
+	Name     string
+	Owner    string // email
+	JoinCode string
+	Members  []string `xml:"Member"` // emails
+	Settings LeagueSettings
+}
+
+/* How the leagues are written to the file */
+type leagueFile struct {
+	XMLName xml.Name  `xml:"Leagues"`
+	Leagues []*League `xml:"League"`
+}
+
+func leagueFileName() string {
+	if options.LeagueFile != "" {
+		return options.LeagueFile
+	}
+	return "leagues.xml"
+}
+
+/**********************************************************/
+
+/* Caller must hold the store lock.  No file is no leagues. */
+func loadLeagues() error {
+	store.leagues = make(map[string]*League)
+
+	fileName := leagueFileName()
+	b, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var lf leagueFile
+	if err := xml.Unmarshal(b, &lf); err != nil {
+		return fmt.Errorf("%s: %v", fileName, err)
+	}
+
+	for _, l := range lf.Leagues {
+		store.leagues[l.ID] = l
+	}
+	log.Println("loaded", len(store.leagues), "leagues from", fileName)
+
+	return nil
+}
+
+/* Caller must hold the store lock, at least for reading */
+func saveLeagues() error {
+	lf := leagueFile{Leagues: make([]*League, 0, len(store.leagues))}
+	for _, l := range store.leagues {
+		lf.Leagues = append(lf.Leagues, l)
+	}
+	sort.Slice(lf.Leagues, func(i, j int) bool { return lf.Leagues[i].ID < lf.Leagues[j].ID })
+
+	b, err := xml.MarshalIndent(&lf, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	fileName := leagueFileName()
+	if err := writeFileAtomic(fileName, b); err != nil {
+		return err
+	}
+	log.Println("saved leagues to", fileName)
+
+	return nil
+}
+
+/**********************************************************/
+
+/* Caller must hold the store lock.  Starts a league with the
+ * owner as its only member. */
+func newLeague(name string, owner *User) (*League, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("no league name entered")
+	}
+	if len(name) > 40 {
+		return nil, fmt.Errorf("league name must be less than 40 characters")
+	}
+
+	/* the id is the name made safe for a URL */
+	id := strings.Map(func(c rune) rune {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+			return c
+		case c >= 'A' && c <= 'Z':
+			return c - 'A' + 'a'
+		}
+		return '-'
+	}, name)
+	if _, ok := store.leagues[id]; ok {
+		return nil, fmt.Errorf("there is already a league called %s", name)
+	}
+
+	code := make([]byte, 5)
+	if _, err := rand.Read(code); err != nil {
+		return nil, err
+	}
+
+	l := &League{
+		ID:       id,
+		Name:     name,
+		Owner:    owner.Email,
+		JoinCode: hex.EncodeToString(code),
+		Members:  []string{owner.Email},
+	}
+	store.leagues[id] = l
+	log.Println("user", owner.Email, "started league", id)
+
+	return l, nil
+}
+
+/* Caller must hold the store lock, at least for reading */
+func leagueByJoinCode(code string) *League {
+	code = strings.TrimSpace(code)
+	for _, l := range store.leagues {
+		if code != "" && l.JoinCode == code {
+			return l
+		}
+	}
+	return nil
+}
+
+func (l *League) isMember(email string) bool {
+	for _, m := range l.Members {
+		if m == email {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *League) addMember(email string) {
+	if !l.isMember(email) {
+		l.Members = append(l.Members, email)
+	}
+}
+
+func (l *League) removeMember(email string) {
+	for i, m := range l.Members {
+		if m == email {
+			l.Members = append(l.Members[:i], l.Members[i+1:]...)
+			return
+		}
+	}
+}
+
+/* Whether the user counts in the league's standings,
+ * with no league everybody does */
+func (l *League) includes(u *User) bool {
+	return l == nil || l.isMember(u.Email)
+}
+
+func (l *League) canManage(user *User) bool {
+	return user != nil && (user.Email == l.Owner || isAdmin(user))
+}
+
+func (l *League) playoffMode() string {
+	if l != nil && l.Settings.PlayoffStandings != "" {
+		return l.Settings.PlayoffStandings
+	}
+	return options.PlayoffStandings
+}
+
+/* Whether the league is a survivor pool */
+func (l *League) survivor() bool {
+	return l != nil && l.Settings.PoolMode == "survivor"
+}
+
+/* Whether the league picks against the spread */
+func (l *League) ats() bool {
+	return l != nil && l.Settings.PoolMode == "ats"
+}
+
+/* Caller must hold the store lock, at least for reading.  The user's
+ * weeks as the league scores them, see survivorWeeks() and atsWeeks(). */
+func (l *League) weeks(u *User, year int) []UserWeek {
+	weeks := u.weeks(year)
+	switch {
+	case l.survivor():
+		return survivorWeeks(seasonFor(year), weeks)
+	case l.ats():
+		return atsWeeks(seasonFor(year), weeks)
+	}
+	return weeks
+}
+
+/* Caller must hold the store lock, at least for reading.
+ * The leagues the user is in, by name. */
+func leaguesOf(user *User) []*League {
+	leagues := make([]*League, 0)
+	for _, l := range store.leagues {
+		if l.isMember(user.Email) {
+			leagues = append(leagues, l)
+		}
+	}
+	sort.Slice(leagues, func(i, j int) bool { return leagues[i].Name < leagues[j].Name })
+	return leagues
+}
+
+/* Caller must hold the store lock, at least for reading.  Whether
+ * the user can see the player's picks and results: it is the user,
+ * they share a league or neither is in one.  The administrator can
+ * see everybody, a nil user only the players in no league. */
+func canView(user *User, player *User) bool {
+	if user != nil && (user == player || isAdmin(user)) {
+		return true
+	}
+
+	userIn, playerIn := false, false
+	for _, l := range store.leagues {
+		u := user != nil && l.isMember(user.Email)
+		p := l.isMember(player.Email)
+		if u && p {
+			return true
+		}
+		userIn = userIn || u
+		playerIn = playerIn || p
+	}
+	return !userIn && !playerIn
+}
+
+/* Caller must hold the store lock, at least for reading.  What the
+ * pages without ?league= show the user: the user's league if there is
+ * just one, or else the players the user can see with the pool's
+ * settings.  nil, everybody, when there are no leagues and for the
+ * administrator. */
+func defaultLeague(user *User) *League {
+	if len(store.leagues) == 0 || (user != nil && isAdmin(user)) {
+		return nil
+	}
+	if user != nil {
+		if leagues := leaguesOf(user); len(leagues) == 1 {
+			return leagues[0]
+		}
+	}
+
+	view := &League{}
+	for _, u := range store.users {
+		if canView(user, u) {
+			view.Members = append(view.Members, u.Email)
+		}
+	}
+	return view
+}
+
+/* Caller must hold the store lock, at least for reading.  The league
+ * asked for with ?league=<id>, defaultLeague() if none is asked for.
+ * Only the league's members and the administrator can see it. */
+func requestLeague(r *http.Request, user *User) (*League, error) {
+	id := r.FormValue("league")
+	if id == "" {
+		return defaultLeague(user), nil
+	}
+	l, ok := store.leagues[id]
+	if !ok {
+		return nil, fmt.Errorf("no league %s", id)
+	}
+	if user == nil || (!l.isMember(user.Email) && !isAdmin(user)) {
+		return nil, fmt.Errorf("not a member of league %s", l.Name)
+	}
+
+	return l, nil
+}
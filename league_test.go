@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLeagues(t *testing.T) {
+	newTestStore(t, 2022, nil, nil)
+	store.iWeek = 1
+	store.seasonEnded = true
+	for i, name := range []string{"fred", "barney", "wilma"} {
+		u := addTestUser(name)
+		u.UserWeeks[0].Selections = []Selection{{Team: "CHI", Confidence: 16}}
+		u.UserWeeks[0].Points = 10 * (i + 1)
+	}
+	fred, barney, wilma := store.users["fred@foo.com"], store.users["barney@foo.com"], store.users["wilma@foo.com"]
+
+	office, err := newLeague("The Office", fred)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if office.ID != "the-office" || !office.isMember(fred.Email) || office.JoinCode == "" {
+		t.Error("bad league", office)
+	}
+	if _, err := newLeague("the office", barney); err == nil {
+		t.Error("expected an error for a second league with the same id")
+	}
+
+	if l := leagueByJoinCode(office.JoinCode); l != office {
+		t.Fatal("join code not found")
+	}
+	office.addMember(wilma.Email)
+
+	if s := seasonStandings(2022, office); len(s) != 2 || s[0].Name != "wilma" {
+		t.Error("wrong league standings", s)
+	}
+	if s := seasonStandings(2022, nil); len(s) != 3 {
+		t.Error("wrong standings for everybody", s)
+	}
+
+	/* barney is not in the league */
+	r := httptest.NewRequest("GET", "/api/v1/standings?league=the-office", nil)
+	if _, err := requestLeague(r, barney); err == nil {
+		t.Error("barney can see the office league")
+	}
+	if l, err := requestLeague(r, wilma); err != nil || l != office {
+		t.Error("wilma can not see the office league", err)
+	}
+
+	/* without ?league= each sees the players they share a league with */
+	if s := seasonStandings(2022, defaultLeague(wilma)); len(s) != 2 {
+		t.Error("wrong default standings for wilma", s)
+	}
+	if s := seasonStandings(2022, defaultLeague(barney)); len(s) != 1 || s[0].Name != "barney" {
+		t.Error("wrong default standings for barney", s)
+	}
+	if !canView(wilma, fred) || canView(barney, fred) || canView(fred, barney) || canView(nil, fred) {
+		t.Error("league members and others can see each other")
+	}
+	mux := newMux()
+	for who, want := range map[*User]int{wilma: http.StatusOK, barney: http.StatusNotFound} {
+		r := httptest.NewRequest("GET", "/api/v1/results/fred@foo.com/0", nil)
+		r.AddCookie(testCookie(who))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != want {
+			t.Error(who.Name, "got fred's results with status", w.Code)
+		}
+	}
+
+	if err := saveLeagues(); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadLeagues(); err != nil {
+		t.Fatal(err)
+	}
+	l := store.leagues["the-office"]
+	if l == nil || l.Name != "The Office" || len(l.Members) != 2 || l.Owner != fred.Email {
+		t.Error("league not saved", l)
+	}
+}
@@ -0,0 +1,640 @@
+package main
+
+/* The money, when options.Ledger or a league's settings have a fee
+ * or a payout.
+ *
+ * There is a ledger for the pool everybody is in, with the rules in
+ * options.Ledger, and one for each league with rules of its own in
+ * its settings.  A league's ledger only has its members and goes by
+ * the league's standings, so a survivor or against the spread league
+ * pays out on its own scoring, see League.weeks().
+ *
+ * Amounts are in cents.  Each player who made picks in a season owes
+ * the EntryFee for it.  Each week that counts in the standings pays
+ * WeeklyPot to its winners, see weekWinners(), split evenly when they
+ * are tied; a cent that does not split goes to the first winners by
+ * email.  When the season is over SeasonPayouts pay the first,
+ * second, ... places of the standings, players tied on points share
+ * the payouts for the places they take.
+ *
+ * All of that is worked out from the standings every time, so it
+ * follows the scores as they are corrected.  Only what an
+ * administrator enters by hand, payments received and the like, is
+ * saved, to options.LedgerFile (default ledger.xml), each entry with
+ * its league.  A player's balance is what the pool or the league
+ * owes them, negative if they owe it.
+ *
+ * /ledger shows the logged in player's entries for a season,
+ * ?season=<year>, in the pool's ledger or with ?league=<id> in a
+ * league's, and ?csv=1 downloads them.  Administrators can look at
+ * anybody's with ?player=<email> and enter adjustments on
+ * /admin/ledger. */
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type LedgerRules struct {
+	EntryFee      int   // each player pays for the season
+	WeeklyPot     int   // to the week's winners, split on a tie
+	SeasonPayouts []int // to first, second, ... in the season standings
+}
+
+type LedgerEntry struct {
+	Year   int    `xml:"Year,attr"`
+	League string `xml:"League,attr,omitempty"` // league ID, "" for the pool
+	Email  string
+	Cents  int // to the player, negative from the player
+	What   string
+	When   string `xml:",omitempty"` // time an adjustment was entered
+}
+
+/* How the adjustments are written to the file */
+type ledgerFile struct {
+	XMLName xml.Name      `xml:"Ledger"`
+	Entries []LedgerEntry `xml:"Entry"`
+}
+
+func ledgerFileName() string {
+	if options.LedgerFile != "" {
+		return options.LedgerFile
+	}
+	return "ledger.xml"
+}
+
+func (rules LedgerRules) on() bool {
+	return rules.EntryFee > 0 || rules.WeeklyPot > 0 || len(rules.SeasonPayouts) > 0
+}
+
+/* The league's fees and payouts, options.Ledger for the pool */
+func (l *League) ledgerRules() LedgerRules {
+	if l == nil {
+		return options.Ledger
+	}
+	return l.Settings.Ledger
+}
+
+/* The league's ID, "" for the pool */
+func (l *League) ledgerID() string {
+	if l == nil {
+		return ""
+	}
+	return l.ID
+}
+
+/* Caller must hold the store lock, at least for reading.  The
+ * ledgers the user can look at, nil for the pool's: the pool's if it
+ * has any rules, then the user's leagues that do, every league's for
+ * the administrator. */
+func ledgersOf(user *User) []*League {
+	ledgers := make([]*League, 0)
+	if options.Ledger.on() {
+		ledgers = append(ledgers, nil)
+	}
+
+	leagues := leaguesOf(user)
+	if isAdmin(user) {
+		leagues = make([]*League, 0, len(store.leagues))
+		for _, l := range store.leagues {
+			leagues = append(leagues, l)
+		}
+		sort.Slice(leagues, func(i, j int) bool { return leagues[i].Name < leagues[j].Name })
+	}
+	for _, l := range leagues {
+		if l.ledgerRules().on() {
+			ledgers = append(ledgers, l)
+		}
+	}
+	return ledgers
+}
+
+/* Caller must hold the store lock, at least for reading.  The ledger
+ * asked for with ?league=<id>, or else the first the user has. */
+func requestLedger(r *http.Request, user *User) (*League, error) {
+	if r.FormValue("league") != "" {
+		return requestLeague(r, user)
+	}
+	if ledgers := ledgersOf(user); len(ledgers) > 0 {
+		return ledgers[0], nil
+	}
+	return nil, nil
+}
+
+/* "$12.50", "-$3.00" */
+func money(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s$%d.%02d", sign, cents/100, cents%100)
+}
+
+/* Dollars as typed, "12.50", "-3" or "$5", to cents */
+func parseMoney(s string) (int, error) {
+	s = strings.Replace(strings.TrimSpace(s), "$", "", 1)
+	dollars, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.Abs(dollars) > 1e6 {
+		return 0, fmt.Errorf("%q is not an amount of money", s)
+	}
+	return int(math.Round(dollars * 100)), nil
+}
+
+/* The rules as typed in dollars, "" for nothing, and the
+ * season payouts separated by commas */
+func parseLedgerRules(fee string, pot string, payouts string) (LedgerRules, error) {
+	var rules LedgerRules
+	amounts := []*int{&rules.EntryFee, &rules.WeeklyPot}
+	for i, s := range []string{fee, pot} {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		cents, err := parseMoney(s)
+		if err != nil {
+			return rules, err
+		}
+		*amounts[i] = cents
+	}
+	for _, s := range strings.Split(payouts, ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		cents, err := parseMoney(s)
+		if err != nil {
+			return rules, err
+		}
+		rules.SeasonPayouts = append(rules.SeasonPayouts, cents)
+	}
+
+	if rules.EntryFee < 0 || rules.WeeklyPot < 0 {
+		return rules, fmt.Errorf("the fee and the pot can not be negative")
+	}
+	for _, cents := range rules.SeasonPayouts {
+		if cents < 0 {
+			return rules, fmt.Errorf("a payout can not be negative")
+		}
+	}
+	return rules, nil
+}
+
+/* pot split n ways, the cents left over to the first shares */
+func splitPot(pot int, n int) []int {
+	shares := make([]int, n)
+	for i := range shares {
+		shares[i] = pot / n
+		if i < pot%n {
+			shares[i]++
+		}
+	}
+	return shares
+}
+
+/**********************************************************/
+
+/* Caller must hold the store lock.  No file is no adjustments. */
+func loadLedger() error {
+	store.ledger = nil
+
+	fileName := ledgerFileName()
+	b, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var lf ledgerFile
+	if err := xml.Unmarshal(b, &lf); err != nil {
+		return fmt.Errorf("%s: %v", fileName, err)
+	}
+	store.ledger = lf.Entries
+	log.Println("loaded", len(store.ledger), "ledger adjustments from", fileName)
+
+	return nil
+}
+
+/* Caller must hold the store lock, at least for reading */
+func saveLedger() error {
+	b, err := xml.MarshalIndent(&ledgerFile{Entries: store.ledger}, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	fileName := ledgerFileName()
+	if err := writeFileAtomic(fileName, b); err != nil {
+		return err
+	}
+	log.Println("saved ledger to", fileName)
+
+	return nil
+}
+
+/* Caller must hold the store lock */
+func addLedgerAdjustment(year int, league *League, user *User, cents int, what string) error {
+	if cents == 0 {
+		return fmt.Errorf("No amount entered")
+	}
+	what = strings.TrimSpace(what)
+	if what == "" {
+		return fmt.Errorf("Say what the adjustment is for")
+	}
+
+	store.ledger = append(store.ledger, LedgerEntry{
+		Year:   year,
+		League: league.ledgerID(),
+		Email:  user.Email,
+		Cents:  cents,
+		What:   what,
+		When:   time.Now().Round(0).String(), // Round(0) strips monotonic clock reading
+	})
+	return saveLedger()
+}
+
+/**********************************************************/
+
+/* Caller must hold the store lock, at least for reading.  The fees
+ * and payouts in the league's ledger, or with no league the pool's,
+ * for the season by email, worked out from the scores. */
+func ledgerCredits(year int, league *League) map[string][]LedgerEntry {
+	credits := make(map[string][]LedgerEntry)
+	season := seasonFor(year)
+	if season == nil {
+		return credits
+	}
+	rules := league.ledgerRules()
+	id := league.ledgerID()
+
+	/* by email so splitting the pots always comes out the same */
+	players := make([]*User, 0, len(store.users))
+	userWeeks := make(map[*User][]UserWeek)
+	for _, u := range store.users {
+		if weeks := league.weeks(u, year); league.includes(u) && played(weeks) {
+			players = append(players, u)
+			userWeeks[u] = weeks
+		}
+	}
+	sort.Slice(players, func(i, j int) bool { return players[i].Email < players[j].Email })
+
+	for _, u := range players {
+		if rules.EntryFee > 0 {
+			credits[u.Email] = append(credits[u.Email],
+				LedgerEntry{Year: year, League: id, Email: u.Email, Cents: -rules.EntryFee, What: "Entry fee"})
+		}
+	}
+
+	lastIWeek := standingsWeeks(season)
+	for i := 0; i < lastIWeek && rules.WeeklyPot > 0; i++ {
+		week := &season.Week[i]
+		if !countsInStandings(week, false, league) {
+			continue
+		}
+
+		who := make([]*User, 0, len(players))
+		weekly := make([]*UserWeek, 0, len(players))
+		for _, u := range players {
+			weeks := userWeeks[u]
+			if i < len(weeks) && weeks[i].Selections != nil {
+				who = append(who, u)
+				weekly = append(weekly, &weeks[i])
+			}
+		}
+
+		winners := make([]*User, 0, 1)
+		for j, won := range weekWinners(week, weekly) {
+			if won {
+				winners = append(winners, who[j])
+			}
+		}
+		if len(winners) == 0 {
+			continue
+		}
+
+		what := "Won " + week.name()
+		if len(winners) > 1 {
+			what = fmt.Sprintf("Split %s %d ways", week.name(), len(winners))
+		}
+		for j, share := range splitPot(rules.WeeklyPot, len(winners)) {
+			credits[winners[j].Email] = append(credits[winners[j].Email],
+				LedgerEntry{Year: year, League: id, Email: winners[j].Email, Cents: share, What: what})
+		}
+	}
+
+	seasonOver := season != &store.season || store.seasonEnded
+	if !seasonOver || len(rules.SeasonPayouts) == 0 {
+		return credits
+	}
+
+	rows := make([]StandingRow, 0, len(players))
+	for _, row := range seasonStandings(year, league) {
+		if row.WeeksPlayed > 0 {
+			rows = append(rows, row)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].Total != rows[j].Total {
+			return rows[i].Total > rows[j].Total
+		}
+		return rows[i].email < rows[j].email
+	})
+
+	/* the players tied at place i share the payouts of places i to j */
+	for i := 0; i < len(rows) && i < len(rules.SeasonPayouts); {
+		j := i + 1
+		for j < len(rows) && rows[j].Total == rows[i].Total {
+			j++
+		}
+		pot := 0
+		for p := i; p < j && p < len(rules.SeasonPayouts); p++ {
+			pot += rules.SeasonPayouts[p]
+		}
+
+		what := fmt.Sprintf("Finished %s in %d", ordinal(i+1), year)
+		if j-i > 1 {
+			what = fmt.Sprintf("Tied for %s in %d", ordinal(i+1), year)
+		}
+		for k, share := range splitPot(pot, j-i) {
+			email := rows[i+k].email
+			credits[email] = append(credits[email], LedgerEntry{Year: year, League: id, Email: email, Cents: share, What: what})
+		}
+		i = j
+	}
+
+	return credits
+}
+
+/* Caller must hold the store lock, at least for reading.  The
+ * user's fees, payouts and adjustments for the season in the
+ * league's ledger, credits from ledgerCredits() for the league. */
+func ledgerFor(year int, league *League, user *User, credits map[string][]LedgerEntry) []LedgerEntry {
+	entries := append([]LedgerEntry(nil), credits[user.Email]...)
+	for _, e := range store.ledger {
+		if e.Year == year && e.League == league.ledgerID() && e.Email == user.Email {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+func balance(entries []LedgerEntry) int {
+	cents := 0
+	for _, e := range entries {
+		cents += e.Cents
+	}
+	return cents
+}
+
+func ordinal(n int) string {
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+/* The entries with a running balance, for a spreadsheet */
+func writeLedgerCSV(w io.Writer, entries []LedgerEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"Season", "What", "When", "Amount", "Balance"})
+
+	cents := 0
+	for _, e := range entries {
+		cents += e.Cents
+		cw.Write([]string{strconv.Itoa(e.Year), e.What, e.When, fmt.Sprintf("%.2f", float64(e.Cents)/100),
+			fmt.Sprintf("%.2f", float64(cents)/100)})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+/**********************************************************/
+
+func ledgerGetHandler(w http.ResponseWriter, r *http.Request) {
+	user := getSessionUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+
+	season := requestSeason(r)
+	if season == nil {
+		errorPage(w, "No season %s", r.FormValue("season"))
+		return
+	}
+
+	player := user
+	if email := r.FormValue("player"); email != "" && email != user.Email {
+		if !isAdmin(user) {
+			errorPage(w, "Only an administrator can look at somebody else's ledger")
+			return
+		}
+		var ok bool
+		if player, ok = store.users[email]; !ok {
+			errorPage(w, "No player %s", email)
+			return
+		}
+	}
+
+	league, err := requestLedger(r, user)
+	if err != nil {
+		errorPage(w, "%s", err.Error())
+		return
+	}
+
+	entries := ledgerFor(season.Year, league, player, ledgerCredits(season.Year, league))
+
+	if r.FormValue("csv") != "" {
+		fileName := fmt.Sprintf("ledger-%d.csv", season.Year)
+		if league != nil {
+			fileName = fmt.Sprintf("ledger-%s-%d.csv", league.ID, season.Year)
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
+		if err := writeLedgerCSV(w, entries); err != nil {
+			log.Println("ledger csv:", err.Error())
+		}
+		return
+	}
+
+	type EntryRow struct {
+		What    string
+		When    string
+		Cents   int
+		Balance int
+	}
+	rows := make([]EntryRow, 0, len(entries))
+	cents := 0
+	for _, e := range entries {
+		cents += e.Cents
+		when := ""
+		if t, err := time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", e.When); err == nil {
+			when = t.Format("Mon Jan _2 2006")
+		}
+		rows = append(rows, EntryRow{What: e.What, When: when, Cents: e.Cents, Balance: cents})
+	}
+
+	data := struct {
+		Name    string
+		Player  string
+		Email   string
+		Year    int
+		Years   []int
+		League  *League
+		Ledgers []*League
+		Rows    []EntryRow
+		Balance int
+	}{
+		Name:    user.Name,
+		Player:  player.Name,
+		Email:   player.Email,
+		Year:    season.Year,
+		Years:   seasonYears(),
+		League:  league,
+		Ledgers: ledgersOf(user),
+		Rows:    rows,
+		Balance: cents,
+	}
+
+	err = templates.ExecuteTemplate(w, "ledger.html", &data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func adminLedgerGetHandler(w http.ResponseWriter, r *http.Request) {
+	admin := adminUser(w, r)
+	if admin == nil {
+		return
+	}
+
+	season := requestSeason(r)
+	if season == nil {
+		errorPage(w, "No season %s", r.FormValue("season"))
+		return
+	}
+
+	league, err := requestLedger(r, admin)
+	if err != nil {
+		errorPage(w, "%s", err.Error())
+		return
+	}
+
+	type BalanceRow struct {
+		Name        string
+		Email       string
+		Fees        int
+		Winnings    int
+		Adjustments int
+		Balance     int
+	}
+
+	credits := ledgerCredits(season.Year, league)
+	rows := make([]BalanceRow, 0, len(store.users))
+	total := 0
+	for _, u := range store.users {
+		entries := ledgerFor(season.Year, league, u, credits)
+		if len(entries) == 0 {
+			continue
+		}
+		row := BalanceRow{Name: u.Name, Email: u.Email, Balance: balance(entries)}
+		for _, e := range entries {
+			switch {
+			case e.When != "":
+				row.Adjustments += e.Cents
+			case e.Cents < 0:
+				row.Fees += e.Cents
+			default:
+				row.Winnings += e.Cents
+			}
+		}
+		total += row.Balance
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Name < rows[j].Name })
+
+	data := struct {
+		Name    string
+		Year    int
+		Years   []int
+		League  *League
+		Ledgers []*League
+		Rows    []BalanceRow
+		Total   int
+	}{
+		Name:    admin.Name,
+		Year:    season.Year,
+		Years:   seasonYears(),
+		League:  league,
+		Ledgers: ledgersOf(admin),
+		Rows:    rows,
+		Total:   total,
+	}
+
+	err = templates.ExecuteTemplate(w, "adminledger.html", &data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func adminLedgerPostHandler(w http.ResponseWriter, r *http.Request) {
+	admin := adminUser(w, r)
+	if admin == nil {
+		return
+	}
+
+	season := requestSeason(r)
+	if season == nil {
+		errorPage(w, "No season %s", r.FormValue("season"))
+		return
+	}
+	league, err := requestLedger(r, admin)
+	if err != nil {
+		errorPage(w, "%s", err.Error())
+		return
+	}
+	player, ok := store.users[r.FormValue("player")]
+	if !ok || !league.includes(player) {
+		errorPage(w, "No player %s", r.FormValue("player"))
+		return
+	}
+	cents, err := parseMoney(r.FormValue("amount"))
+	if err != nil {
+		errorPage(w, "%s", err.Error())
+		return
+	}
+
+	if err := addLedgerAdjustment(season.Year, league, player, cents, r.FormValue("what")); err != nil {
+		errorPage(w, "%s", err.Error())
+		return
+	}
+
+	target := fmt.Sprintf("/admin/ledger?season=%d", season.Year)
+	if league != nil {
+		audit(admin, "ledger", player.Email, "%d %s %s %s", season.Year, league.ID, money(cents), r.FormValue("what"))
+		target += "&league=" + url.QueryEscape(league.ID)
+	} else {
+		audit(admin, "ledger", player.Email, "%d %s %s", season.Year, money(cents), r.FormValue("what"))
+	}
+
+	http.Redirect(w, r, target, http.StatusFound)
+}
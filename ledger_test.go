@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLedger(t *testing.T) {
+	newTestStore(t, 2021, []Game{finalGame("CHI", "GB", 21, 7, 8)}, []Game{finalGame("CHI", "GB", 21, 7, 1)})
+	store.iWeek = 1
+	store.seasonEnded = true
+	options.Ledger = LedgerRules{EntryFee: 2000, WeeklyPot: 1000, SeasonPayouts: []int{3000, 1000}}
+
+	/* week 1 is a three way tie, fred wins week 2 and the season,
+	 * barney and wilma tie for second, betty did not play */
+	for name, points := range map[string][]int{"fred": {5, 9}, "barney": {5, 2}, "wilma": {5, 2}, "betty": nil} {
+		u := addTestUser(name)
+		for i, p := range points {
+			u.UserWeeks[i].Points = p
+			u.UserWeeks[i].Selections = []Selection{{Team: "CHI", Confidence: p}}
+		}
+	}
+	credits := ledgerCredits(2021, nil)
+	for email, want := range map[string]int{
+		"fred@foo.com":   -2000 + 333 + 1000 + 3000,
+		"barney@foo.com": -2000 + 334 + 500,
+		"wilma@foo.com":  -2000 + 333 + 500,
+		"betty@foo.com":  0,
+	} {
+		if got := balance(ledgerFor(2021, nil, store.users[email], credits)); got != want {
+			t.Error(email, "balance", money(got), "expected", money(want))
+		}
+	}
+
+	/* no season payouts until it is over */
+	store.seasonEnded = false
+	store.iWeek = 2
+	if got := balance(ledgerFor(2021, nil, store.users["fred@foo.com"], ledgerCredits(2021, nil))); got != -2000+333+1000 {
+		t.Error("fred was paid for an unfinished season", money(got))
+	}
+
+	fred := store.users["fred@foo.com"]
+	if err := addLedgerAdjustment(2021, nil, fred, 2000, "Paid entry fee"); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadLedger(); err != nil || len(store.ledger) != 1 {
+		t.Error("adjustment not saved", err, store.ledger)
+	}
+	entries := ledgerFor(2021, nil, fred, ledgerCredits(2021, nil))
+	if got := balance(entries); got != 1333 {
+		t.Error("fred balance", money(got), "expected $13.33")
+	}
+
+	var b bytes.Buffer
+	if err := writeLedgerCSV(&b, entries); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 5 || !strings.HasSuffix(lines[4], ",20.00,13.33") {
+		t.Error("wrong csv", b.String())
+	}
+
+	for s, want := range map[string]int{"12.50": 1250, "-$3": -300, "0.1": 10} {
+		if got, err := parseMoney(s); err != nil || got != want {
+			t.Error("parseMoney", s, got, err)
+		}
+	}
+	if money(-1205) != "-$12.05" {
+		t.Error("money", money(-1205))
+	}
+}
+
+/* A league's ledger has its own rules, members, scoring and
+ * adjustments, apart from the pool's */
+func TestLeagueLedger(t *testing.T) {
+	newTestStore(t, 2021, []Game{finalGame("CHI", "GB", 21, 7, 8), finalGame("NYJ", "NYG", 3, 7, 8)})
+	store.iWeek = 0
+	store.seasonEnded = true
+	mux := newMux()
+
+	/* fred has the most confidence points, but the Packers cover,
+	 * so barney wins against the spread */
+	store.season.Week[0].teamToGame["GB"].Spread = 14.5
+	fred, barney, wilma := addTestUser("fred"), addTestUser("barney"), addTestUser("wilma")
+	fred.UserWeeks[0].Selections = []Selection{{Team: "CHI", Confidence: 9}, {Team: "NYJ", Confidence: 8}}
+	fred.UserWeeks[0].Points = 9
+	barney.UserWeeks[0].Selections = []Selection{{Team: "CHI", Confidence: 2}, {Team: "NYG", Confidence: 1}}
+	barney.UserWeeks[0].Points = 3
+	wilma.UserWeeks[0].Selections = []Selection{{Team: "GB", Confidence: 1}}
+
+	office, err := newLeague("Office", fred)
+	if err != nil {
+		t.Fatal(err)
+	}
+	office.addMember(barney.Email)
+	office.Settings.PoolMode = "ats"
+	office.Settings.Ledger, err = parseLedgerRules("10", "", "$15, 5.00")
+	if err != nil || office.Settings.Ledger.EntryFee != 1000 || len(office.Settings.Ledger.SeasonPayouts) != 2 {
+		t.Fatal("rules not parsed", office.Settings.Ledger, err)
+	}
+	if _, err := parseLedgerRules("-10", "", ""); err == nil {
+		t.Error("negative entry fee accepted")
+	}
+
+	/* the pool has no rules, so only the league pays */
+	credits := ledgerCredits(2021, office)
+	for u, want := range map[*User]int{fred: -1000 + 500, barney: -1000 + 1500, wilma: 0} {
+		if got := balance(ledgerFor(2021, office, u, credits)); got != want {
+			t.Error(u.Email, "league balance", money(got), "expected", money(want))
+		}
+	}
+	if got := balance(ledgerFor(2021, nil, fred, ledgerCredits(2021, nil))); got != 0 {
+		t.Error("fred has a pool balance with no pool rules", money(got))
+	}
+	if ledgers := ledgersOf(fred); len(ledgers) != 1 || ledgers[0] != office {
+		t.Error("expected only the league's ledger", ledgers)
+	}
+
+	if err := addLedgerAdjustment(2021, office, barney, 1000, "Paid entry fee"); err != nil {
+		t.Fatal(err)
+	}
+	if got := balance(ledgerFor(2021, office, barney, ledgerCredits(2021, office))); got != 1500 {
+		t.Error("barney league balance", money(got), "expected $15.00")
+	}
+	if got := balance(ledgerFor(2021, nil, barney, ledgerCredits(2021, nil))); got != 0 {
+		t.Error("league adjustment in the pool's ledger", money(got))
+	}
+
+	get := func(u *User, path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		r.AddCookie(testCookie(u))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+	w := get(barney, "/ledger?season=2021&csv=1")
+	if !strings.Contains(w.Header().Get("Content-Disposition"), "ledger-office-2021.csv") || !strings.HasSuffix(strings.TrimSpace(w.Body.String()), ",10.00,15.00") {
+		t.Error("wrong league csv", w.Header(), w.Body.String())
+	}
+	if w := get(wilma, "/ledger?season=2021&league=office"); !strings.Contains(w.Body.String(), "not a member") {
+		t.Error("wilma can see the league's ledger")
+	}
+
+	if w := get(fred, "/ledger?season=2021"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "fred 2021, Office") {
+		t.Error("league ledger page, status", w.Code, w.Body.String())
+	}
+	wilma.Admin = true
+	if w := get(wilma, "/admin/ledger?season=2021&league=office"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "2021 Balances, Office") {
+		t.Error("admin league ledger page, status", w.Code, w.Body.String())
+	}
+}
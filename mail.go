@@ -0,0 +1,227 @@
+package main
+
+/* Outgoing email.
+ *
+ * options.MailTransport picks how mail leaves the server:
+ *
+ *   "tls"       SMTP over TLS from the start, usually port 465 (default)
+ *   "starttls"  SMTP upgraded with STARTTLS, usually port 587
+ *   "plain"     SMTP with no TLS at all, usually port 25
+ *   "file"      no SMTP, each message is written to a maildir
+ *               under options.MailDir.  For development and tests.
+ *
+ * The SMTP transports log in with options.AdminEmail and
+ * options.AdminEmailPw, and options.AdminEmail is the sender. */
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+var mailer Mailer
+
+/**********************************************************/
+
+func newMailer(o Options) (Mailer, error) {
+	transport := o.MailTransport
+	if transport == "" {
+		transport = "tls"
+	}
+
+	if transport == "file" {
+		dir := o.MailDir
+		if dir == "" {
+			dir = "mail"
+		}
+		m, err := newFileMailer(dir, o.AdminEmail)
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+
+	host := o.MailHost
+	if host == "" {
+		host = "smtp.aol.com"
+	}
+
+	port := o.MailPort
+	if port == 0 {
+		switch transport {
+		case "tls":
+			port = 465
+		case "starttls":
+			port = 587
+		case "plain":
+			port = 25
+		}
+	}
+
+	switch transport {
+	case "tls", "starttls", "plain":
+	default:
+		return nil, fmt.Errorf("unknown MailTransport %q", transport)
+	}
+
+	m := &smtpMailer{
+		transport:  transport,
+		host:       host,
+		port:       port,
+		skipVerify: o.MailSkipVerify,
+		from:       o.AdminEmail,
+		password:   o.AdminEmailPw,
+	}
+	return m, nil
+}
+
+/* Sends mail with the configured mailer */
+func sendEmail(toUser string, subject string, body string) error {
+	if mailer == nil {
+		return errors.New("no mailer configured")
+	}
+	return mailer.Send(toUser, subject, body)
+}
+
+func formatMessage(from string, toUser string, subject string, body string) []byte {
+	fromAddr := mail.Address{Name: "", Address: from}
+	toAddr := mail.Address{Name: "", Address: toUser}
+
+	message := ""
+	message += fmt.Sprintf("From: %s\r\n", fromAddr.String())
+	message += fmt.Sprintf("To: %s\r\n", toAddr.String())
+	message += fmt.Sprintf("Subject: %s\r\n", subject)
+	message += fmt.Sprintf("Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message += "\r\n" + body
+
+	return []byte(message)
+}
+
+/**********************************************************/
+
+type smtpMailer struct {
+	transport  string
+	host       string
+	port       int
+	skipVerify bool
+	from       string
+	password   string
+}
+
+func (m *smtpMailer) Send(toUser string, subject string, body string) error {
+	servername := net.JoinHostPort(m.host, strconv.Itoa(m.port))
+
+	tlsconfig := &tls.Config{
+		InsecureSkipVerify: m.skipVerify,
+		ServerName:         m.host,
+	}
+
+	var c *smtp.Client
+	var err error
+	if m.transport == "tls" {
+		/* servers on 465 want an ssl connection from the very
+		 * beginning, so dial with tls instead of smtp.Dial */
+		var conn *tls.Conn
+		conn, err = tls.Dial("tcp", servername, tlsconfig)
+		if err != nil {
+			return fmt.Errorf("email dial %s: %v", servername, err)
+		}
+		c, err = smtp.NewClient(conn, m.host)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("email client %s: %v", servername, err)
+		}
+	} else {
+		c, err = smtp.Dial(servername)
+		if err != nil {
+			return fmt.Errorf("email dial %s: %v", servername, err)
+		}
+	}
+	defer c.Close()
+
+	if m.transport == "starttls" {
+		if err = c.StartTLS(tlsconfig); err != nil {
+			return fmt.Errorf("email starttls %s: %v", servername, err)
+		}
+	}
+
+	// Auth
+	if m.password != "" {
+		auth := smtp.PlainAuth("", m.from, m.password, m.host)
+		if err = c.Auth(auth); err != nil {
+			return fmt.Errorf("email auth: %v", err)
+		}
+	}
+
+	// To && From
+	if err = c.Mail(m.from); err != nil {
+		return fmt.Errorf("email c.Mail: %v", err)
+	}
+
+	if err = c.Rcpt(toUser); err != nil {
+		return fmt.Errorf("email c.Rcpt %s: %v", toUser, err)
+	}
+
+	// Data
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("email c.Data: %v", err)
+	}
+
+	if _, err = w.Write(formatMessage(m.from, toUser, subject, body)); err != nil {
+		return fmt.Errorf("email w.Write: %v", err)
+	}
+
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("email w.Close: %v", err)
+	}
+
+	return c.Quit()
+}
+
+/**********************************************************/
+
+/* Writes each message to a maildir: first into dir/tmp, then
+ * renamed into dir/new so a reader never sees half a message */
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+var fileMailerCount uint64
+
+func newFileMailer(dir string, from string) (*fileMailer, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, err
+		}
+	}
+	return &fileMailer{dir: dir, from: from}, nil
+}
+
+func (m *fileMailer) Send(toUser string, subject string, body string) error {
+	hostname, _ := os.Hostname()
+	name := fmt.Sprintf("%d.%d_%d.%s", time.Now().Unix(), os.Getpid(),
+		atomic.AddUint64(&fileMailerCount, 1), hostname)
+
+	tmpName := filepath.Join(m.dir, "tmp", name)
+	err := ioutil.WriteFile(tmpName, formatMessage(m.from, toUser, subject, body), 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpName, filepath.Join(m.dir, "new", name))
+}
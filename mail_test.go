@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+
+	m, err := newMailer(Options{MailTransport: "file", MailDir: dir, AdminEmail: "admin@foo.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Send("fred@foo.com", "Hello", "hi fred\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, "new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatal("expected 1 message in maildir, got", len(files))
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "new", files[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(b)
+	for _, want := range []string{"To: <fred@foo.com>", "From: <admin@foo.com>", "Subject: Hello", "hi fred"} {
+		if !strings.Contains(msg, want) {
+			t.Error("message missing", want, ":", msg)
+		}
+	}
+
+	if _, err := newMailer(Options{MailTransport: "pigeon"}); err == nil {
+		t.Error("unknown transport accepted")
+	}
+}
@@ -8,6 +8,9 @@ import (
 	"os"
 )
 
+/* -migrate-users kind:path, copy the users to another user store and exit */
+var migrateUsersTo string
+
 func optionsFromFile() Options {
 
 	var o Options
@@ -18,14 +21,42 @@ func optionsFromFile() Options {
 	//  "UpdateFromWeb":false,
 	//  "ScheduleFromWeb":false,
 	//  "ScheduleUrl":"schedules/2016regular",
+	//  "ScheduleFormat":"html",
+	//  "TeamFile":"teams.json",
 	//  "UpdateUrl":"gameTest1.html",
 	//  "HostWhiteList":"myfbpool.com",
 	//  "PwRecoverSecret":"Secret Phrase",
+	//  "SessionSecret":"Another Secret Phrase",
 	//	"AdminEmail" : "fred@foo.com",
-	//	"AdminEmailPw" : "yabadabadoo"
+	//	"AdminEmailPw" : "yabadabadoo",
+	//	"MailTransport" : "starttls",
+	//	"MailHost" : "smtp.foo.com",
+	//	"MailPort" : 587,
+	//	"UserStore" : "bolt",
+	//	"UserStorePath" : "users.db",
+	//	"Season" : 2021,
+	//	"ArchiveDir" : "seasons",
+	//	"Weeks" : 18,
+	//	"Playoffs" : [
+	//		{"Label" : "Wild Card", "Url" : "schedules/2021wildcard.html"},
+	//		{"Label" : "Divisional", "Url" : "schedules/2021divisional.html"},
+	//		{"Label" : "Conference", "Url" : "schedules/2021conference.html"},
+	//		{"Label" : "Super Bowl", "Url" : "schedules/2021superbowl.html"}
+	//	],
+	//	"PlayoffStandings" : "separate",
+	//	"LeagueFile" : "leagues.xml",
+	//	"AuditLog" : "audit.log",
+	//	"Tiebreaker" : true,
+	//	"TieScoring" : "half",
+	//	"SpreadFile" : "spreads.csv",
+	//	"SpreadFreeze" : "24h",
+	//	"Ledger" : { "EntryFee" : 2000, "WeeklyPot" : 500, "SeasonPayouts" : [ 10000, 5000 ] },
+	//	"LedgerFile" : "ledger.xml",
+	//	"Standings" : { "DropLowest" : 1, "BestOf" : 0, "MissedWeek" : "lowest", "MissedPenalty" : 5 }
 	// }
 
 	flag.StringVar(&configFileName, "config", "options.json", "configuration file")
+	flag.StringVar(&migrateUsersTo, "migrate-users", "", "copy users to another user store (xml:dir or bolt:file) and exit")
 
 	flag.Parse()
 
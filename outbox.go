@@ -0,0 +1,202 @@
+package main
+
+/* Outgoing email queue.
+ *
+ * Mail is not sent from the HTTP handlers.  enqueueEmail() writes
+ * each message as an XML file under options.OutboxDir:
+ *
+ *   pending/  messages waiting to be sent, or to be retried
+ *   failed/   messages we gave up on (the dead letters)
+ *   tmp/      files being written, renamed into pending/ when done
+ *
+ * outboxWorker() sends the pending messages with the configured
+ * Mailer.  A message that fails is retried with exponential backoff
+ * and after outboxMaxAttempts it is moved to failed/. */
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type OutboxMail struct {
+	ID          string
+	To          string
+	Subject     string
+	Body        string
+	Created     time.Time
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+}
+
+const (
+	outboxMaxAttempts  = 10
+	outboxFirstBackoff = 1 * time.Minute
+	outboxMaxBackoff   = 6 * time.Hour
+	outboxPollInterval = 1 * time.Minute
+)
+
+var outboxDir = "outbox"
+
+/* Wakes up the worker when something is queued */
+var outboxPoke = make(chan struct{}, 1)
+
+/**********************************************************/
+
+func initOutbox() error {
+	if options.OutboxDir != "" {
+		outboxDir = options.OutboxDir
+	}
+
+	for _, sub := range []string{"tmp", "pending", "failed"} {
+		if err := os.MkdirAll(filepath.Join(outboxDir, sub), 0700); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func enqueueEmail(toUser string, subject string, body string) error {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	m := OutboxMail{
+		ID:          now.Format("20060102150405") + "-" + hex.EncodeToString(id),
+		To:          toUser,
+		Subject:     subject,
+		Body:        body,
+		Created:     now,
+		NextAttempt: now,
+	}
+
+	if err := writeOutboxMail("pending", &m); err != nil {
+		return err
+	}
+	log.Println("queued email", m.ID, "to", toUser, ":", subject)
+
+	select {
+	case outboxPoke <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+/**********************************************************/
+
+func writeOutboxMail(dir string, m *OutboxMail) error {
+	b, err := xml.MarshalIndent(m, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	tmpName := filepath.Join(outboxDir, "tmp", m.ID+".xml")
+	if err := ioutil.WriteFile(tmpName, b, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpName, filepath.Join(outboxDir, dir, m.ID+".xml"))
+}
+
+/* Returns the messages in the pending or failed directory, oldest first */
+func readOutbox(dir string) []OutboxMail {
+	files, err := ioutil.ReadDir(filepath.Join(outboxDir, dir))
+	if err != nil {
+		log.Println("outbox:", err.Error())
+		return nil
+	}
+
+	mails := make([]OutboxMail, 0, len(files))
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".xml") {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(outboxDir, dir, f.Name()))
+		if err != nil {
+			log.Println("outbox:", err.Error())
+			continue
+		}
+		var m OutboxMail
+		if err := xml.Unmarshal(b, &m); err != nil {
+			log.Println("outbox:", f.Name(), ":", err.Error())
+			continue
+		}
+		mails = append(mails, m)
+	}
+
+	sort.Slice(mails, func(i, j int) bool { return mails[i].Created.Before(mails[j].Created) })
+
+	return mails
+}
+
+func outboxBackoff(attempts int) time.Duration {
+	backoff := outboxFirstBackoff
+	for i := 1; i < attempts && backoff < outboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > outboxMaxBackoff {
+		backoff = outboxMaxBackoff
+	}
+	return backoff
+}
+
+/* Tries to send every pending message that is due */
+func processOutbox(now time.Time) {
+	for _, m := range readOutbox("pending") {
+		if now.Before(m.NextAttempt) {
+			continue
+		}
+
+		m.Attempts++
+		err := sendEmail(m.To, m.Subject, m.Body)
+		if err == nil {
+			log.Println("sent email", m.ID, "to", m.To, "attempt", m.Attempts)
+			if err := os.Remove(filepath.Join(outboxDir, "pending", m.ID+".xml")); err != nil {
+				log.Println("outbox:", err.Error())
+			}
+			continue
+		}
+
+		m.LastError = err.Error()
+		log.Println("email", m.ID, "to", m.To, "attempt", m.Attempts, "failed:", m.LastError)
+
+		if m.Attempts >= outboxMaxAttempts {
+			log.Println("giving up on email", m.ID, "to", m.To)
+			if err := writeOutboxMail("failed", &m); err != nil {
+				log.Println("outbox:", err.Error())
+				continue
+			}
+			if err := os.Remove(filepath.Join(outboxDir, "pending", m.ID+".xml")); err != nil {
+				log.Println("outbox:", err.Error())
+			}
+			continue
+		}
+
+		m.NextAttempt = now.Add(outboxBackoff(m.Attempts))
+		if err := writeOutboxMail("pending", &m); err != nil {
+			log.Println("outbox:", err.Error())
+		}
+	}
+}
+
+func outboxWorker() {
+	for {
+		processOutbox(time.Now())
+
+		select {
+		case <-outboxPoke:
+		case <-time.After(outboxPollInterval):
+		}
+	}
+}
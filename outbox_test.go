@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type flakyMailer struct {
+	fail int
+	sent int
+}
+
+func (m *flakyMailer) Send(to string, subject string, body string) error {
+	if m.fail > 0 {
+		m.fail--
+		return errors.New("mail server is down")
+	}
+	m.sent++
+	return nil
+}
+
+func TestOutbox(t *testing.T) {
+	outboxDir = t.TempDir()
+	if err := initOutbox(); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &flakyMailer{fail: 1}
+	mailer = m
+
+	if err := enqueueEmail("fred@foo.com", "Hello", "hi fred\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	/* first try fails and the message is put off */
+	now := time.Now()
+	processOutbox(now)
+	pending := readOutbox("pending")
+	if len(pending) != 1 || pending[0].Attempts != 1 || !pending[0].NextAttempt.After(now) {
+		t.Fatal("expected 1 pending message to retry later, got", pending)
+	}
+
+	/* not due yet */
+	processOutbox(now)
+	if m.sent != 0 || readOutbox("pending")[0].Attempts != 1 {
+		t.Error("message retried before its backoff")
+	}
+
+	processOutbox(now.Add(outboxBackoff(1)))
+	if m.sent != 1 || len(readOutbox("pending")) != 0 {
+		t.Error("message not sent after backoff, sent", m.sent)
+	}
+
+	/* a message that never goes out ends up in failed */
+	m.fail = outboxMaxAttempts
+	if err := enqueueEmail("barney@foo.com", "Hello", "hi barney\n"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < outboxMaxAttempts; i++ {
+		processOutbox(now.Add(time.Duration(i+1) * outboxMaxBackoff))
+	}
+	failed := readOutbox("failed")
+	if len(failed) != 1 || failed[0].To != "barney@foo.com" || len(readOutbox("pending")) != 0 {
+		t.Error("expected dead letter for barney, got", failed)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+/* Password hashing.
+ *
+ * User.PwHash is stored as "<scheme>$<hash>".  The only scheme we
+ * create is "bcrypt".  Older user files have a bare hex MD5 sum with
+ * no scheme; those still work for login and are replaced with a
+ * bcrypt hash the next time the user logs in successfully. */
+
+import (
+	"crypto/md5"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	pwSchemeBcrypt = "bcrypt"
+	pwSchemeMD5    = "md5" // legacy, never written
+)
+
+const pwBcryptCost = 12
+
+/**********************************************************/
+
+func hashPassword(pass string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(pass), pwBcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return pwSchemeBcrypt + "$" + string(b), nil
+}
+
+/* Splits a stored hash into its scheme and the hash itself */
+func pwHashScheme(pwHash string) (scheme string, hash string) {
+	i := strings.Index(pwHash, "$")
+	if i < 0 {
+		/* no scheme, this is from before we had them */
+		return pwSchemeMD5, pwHash
+	}
+	return pwHash[:i], pwHash[i+1:]
+}
+
+/* Checks pass against the user's stored hash.  The second
+ * return value is true when the stored hash should be replaced
+ * because it uses an old scheme or cost. */
+func checkPassword(user *User, pass string) (ok bool, rehash bool) {
+	scheme, hash := pwHashScheme(user.PwHash)
+
+	switch scheme {
+	case pwSchemeBcrypt:
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) != nil {
+			return false, false
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		return true, err != nil || cost < pwBcryptCost
+	case pwSchemeMD5:
+		md5Hash := fmt.Sprintf("%x", md5.Sum([]byte(pass)))
+		if subtle.ConstantTimeCompare([]byte(md5Hash), []byte(hash)) != 1 {
+			return false, false
+		}
+		return true, true
+	}
+
+	return false, false
+}
+
+/**********************************************************/
+
+/* The rules for a new password, used by registration,
+ * password reset and password update */
+func validatePassword(pass string, pas2 string) error {
+	if len(pass) == 0 {
+		return errors.New("no password entered")
+	}
+
+	if pass != pas2 {
+		return errors.New("passwords do not agree")
+	}
+
+	return nil
+}
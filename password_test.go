@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPassword(t *testing.T) {
+	pwHash, err := hashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(pwHash, pwSchemeBcrypt+"$") {
+		t.Error("unexpected hash format", pwHash)
+	}
+
+	user := &User{PwHash: pwHash}
+	if ok, rehash := checkPassword(user, "secret"); !ok || rehash {
+		t.Error("bcrypt check failed, ok", ok, "rehash", rehash)
+	}
+	if ok, _ := checkPassword(user, "wrong"); ok {
+		t.Error("bcrypt accepted the wrong password")
+	}
+
+	/* user file from before password schemes */
+	user.PwHash = fmt.Sprintf("%x", md5.Sum([]byte("secret")))
+	if ok, rehash := checkPassword(user, "secret"); !ok || !rehash {
+		t.Error("md5 check failed, ok", ok, "rehash", rehash)
+	}
+	if ok, _ := checkPassword(user, "wrong"); ok {
+		t.Error("md5 accepted the wrong password")
+	}
+}
+
+/* Logging in with an MD5 hash upgrades it to bcrypt */
+func TestLoginRehash(t *testing.T) {
+	newTestStore(t, 2021, nil)
+	mux := newMux()
+
+	u := addTestUser("fred")
+	u.PwHash = fmt.Sprintf("%x", md5.Sum([]byte("secret")))
+
+	r := httptest.NewRequest("POST", "/login", strings.NewReader(url.Values{"name": {u.Email}, "password": {"secret"}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/user" || len(w.Result().Cookies()) == 0 {
+		t.Error("login failed, status", w.Code, w.Header())
+	}
+	if scheme, _ := pwHashScheme(u.PwHash); scheme != pwSchemeBcrypt {
+		t.Error("password hash not upgraded", u.PwHash)
+	}
+}
+
+/* Registering, updating and resetting a password, the handlers
+ * hash without the store lock and take it to save */
+func TestPasswordHandlers(t *testing.T) {
+	newTestStore(t, 2021, nil)
+	initOutbox()
+	options.PwRecoverSecret = "reset secret"
+	mux := newMux()
+
+	post := func(path string, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	w := post("/Register", url.Values{"email": {"fred@foo.com"}, "nickname": {"fred"}, "password": {"secret1"}, "password2": {"secret1"}}, nil)
+	fred := store.users["fred@foo.com"]
+	if w.Code != http.StatusFound || fred == nil || len(w.Result().Cookies()) == 0 {
+		t.Fatal("register failed, status", w.Code)
+	}
+	if w := post("/Register", url.Values{"email": {"bob@foo.com"}, "nickname": {"fred"}, "password": {"secret1"}, "password2": {"secret1"}}, nil); store.users["bob@foo.com"] != nil {
+		t.Error("registered a taken nickname, status", w.Code)
+	}
+
+	w = post("/UpdatePassword", url.Values{"current": {"secret1"}, "password": {"secret2"}, "password2": {"secret2"}}, w.Result().Cookies()[0])
+	if ok, _ := checkPassword(fred, "secret2"); w.Code != http.StatusFound || !ok || fred.SessionGen != 1 {
+		t.Error("password not updated, status", w.Code, fred.SessionGen)
+	}
+
+	token := NewSinceNow(fred.Email, time.Hour, []byte(options.PwRecoverSecret))
+	w = post("/Reset?token="+url.QueryEscape(token), url.Values{"password": {"secret3"}, "password2": {"secret3"}}, nil)
+	if ok, _ := checkPassword(fred, "secret3"); w.Code != http.StatusFound || !ok || fred.SessionGen != 2 {
+		t.Error("password not reset, status", w.Code, fred.SessionGen)
+	}
+}
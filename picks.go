@@ -0,0 +1,307 @@
+package main
+
+/* Saving a user's picks for a week and showing how they did,
+ * shared by the HTML pages (websrv.go) and the JSON API (api.go) */
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+)
+
+/* For a game, returns the team the user picks to win and the
+ * confidence, or false if the user made no pick for the game */
+type PickChooser func(game Game) (team string, confidence int, ok bool)
+
+/* Caller must hold the store lock.  Games that have started are
+ * skipped.  If the picks are not valid nothing is changed and
+ * the error says why. */
+func savePicks(user *User, week int, choose PickChooser) error {
+	return setPicks(user, week, choose, false)
+}
+
+/* Caller must hold the store lock.  Like savePicks(), but for the
+ * administrator: games that have started can be changed, and a
+ * team of "" takes the pick for the game away. */
+func adminSavePicks(user *User, week int, choose PickChooser) error {
+	return setPicks(user, week, choose, true)
+}
+
+func setPicks(user *User, week int, choose PickChooser, anyTime bool) error {
+	if week < 0 || week >= len(store.season.Week) || week >= len(user.UserWeeks) {
+		return fmt.Errorf("week index %d does not exist", week)
+	}
+
+	/* work on a copy so a bad set of picks changes nothing */
+	selections := make([]Selection, len(user.UserWeeks[week].Selections))
+	copy(selections, user.UserWeeks[week].Selections)
+
+	var pSelection *Selection
+
+	when := time.Now().Round(0) // Round(0) strips monotonic clock reading
+	for _, game := range store.season.Week[week].Games {
+		if !anyTime && (game.Status == InProgress || game.Status == Finished) {
+			continue
+		}
+
+		if !anyTime && game.Status == Future {
+			gameTime := game.Day.AddDayTime(game.Time)
+			if when.After(gameTime) {
+				/* We have not updated the game status yet,
+				 * but we are past the start of the game.  */
+				log.Println("user", user.Name, "ignoring selection", game.TeamV, game.TeamH, "it started", gameTime)
+				continue
+			}
+		}
+
+		whoWins, confidence, ok := choose(game)
+		if !ok {
+			continue
+		}
+
+		if anyTime && whoWins == "" {
+			for is, s := range selections {
+				if s.Team == game.TeamV || s.Team == game.TeamH {
+					selections = append(selections[:is], selections[is+1:]...)
+					break
+				}
+			}
+			continue
+		}
+
+		if whoWins != game.TeamV && whoWins != game.TeamH {
+			return fmt.Errorf("%s is not playing in %s at %s", whoWins, game.TeamV, game.TeamH)
+		}
+
+		/* see if the user already made a selection for this game */
+		pSelection = nil
+		for is, s := range selections {
+			if s.Team == game.TeamV || s.Team == game.TeamH {
+				pSelection = &selections[is]
+				break
+			}
+		}
+
+		if pSelection == nil {
+			/* no previous selection, append to user's selections */
+			selection := Selection{Team: whoWins, Confidence: confidence, When: when.String()}
+			selections = append(selections, selection)
+		} else {
+			/* has the selection changed? If it hasn't, do nothing */
+			if pSelection.Team != whoWins || pSelection.Confidence != confidence {
+				pSelection.Team = whoWins
+				pSelection.Confidence = confidence
+				pSelection.When = when.String()
+			}
+		}
+	}
+
+	/* Make sure confidence values are not repeated */
+	/* 16 is the max confidence values even if there are less than 16 games,
+	 * except in the playoffs, see maxConfidence().
+	 * Use range 1..maxConfidence in this array */
+	maxConfidence := store.season.Week[week].maxConfidence()
+	validArray := make([]string, maxConfidence+1)
+	log.Println(selections)
+	for _, s := range selections {
+		if s.Confidence > maxConfidence {
+			log.Println("Error: user", user.Email, "selection", s.Team, "over confidence value:", s.Confidence)
+			return fmt.Errorf("Confidence value of %d for %s can not be greater than %d", s.Confidence, s.Team, maxConfidence)
+		}
+		if s.Confidence < 1 {
+			log.Println("Error: user", user.Email, "selection", s.Team, "under confidence value:", s.Confidence)
+			return fmt.Errorf("Confidence value of %d for %s can not be less than 1", s.Confidence, s.Team)
+		}
+		if validArray[s.Confidence] == "" {
+			validArray[s.Confidence] = s.Team
+		} else {
+			return fmt.Errorf("Can not reuse confidences, you have both %s and %s with a confidence of %d",
+				s.Team, validArray[s.Confidence], s.Confidence)
+		}
+	}
+
+	if len(selections) == 0 {
+		/* so the week does not count as played */
+		selections = nil
+	}
+	user.UserWeeks[week].Selections = selections
+	writeUserFile(user)
+
+	return nil
+}
+
+/**********************************************************/
+
+/* A row in the results table for one of the player's picks */
+type ResultsRow struct {
+	Time       string     `json:"time"`
+	TeamV      string     `json:"visitor"`
+	TeamH      string     `json:"home"`
+	ScoreV     string     `json:"visitorScore"`
+	ScoreH     string     `json:"homeScore"`
+	Status     GameStatus `json:"-"`
+	Pick       string     `json:"pick"`
+	Confidence int        `json:"confidence"`
+	Winner     string     `json:"winner"`
+	Points     int        `json:"points"`
+	Line       string     `json:"line,omitempty"` // the spread, see spread.go
+}
+
+/* Caller must hold the store lock, at least for reading.
+ * The picks in weeks[iw] for week index iw of the season,
+ * split by game status. */
+func weekResults(season *Season, weeks []UserWeek, iw int, ats bool) (finished []ResultsRow, inProgress []ResultsRow, future []ResultsRow) {
+	finished = make([]ResultsRow, 0)
+	inProgress = make([]ResultsRow, 0)
+	future = make([]ResultsRow, 0)
+
+	if iw >= len(weeks) {
+		return finished, inProgress, future
+	}
+
+	for _, s := range weeks[iw].Selections {
+		var game Game
+		found := false
+		for _, game = range season.Week[iw].Games {
+			if s.Team == game.TeamH || s.Team == game.TeamV {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			log.Println("Results game not found for weekIndx", iw, "selection", s)
+			continue
+		}
+
+		time := game.Time
+		if game.Status == Future {
+			time = game.Day.AddDayTime(game.Time).Format("Mon Jan _2 3:04:05PM MST")
+		}
+
+		score, ok := scorePick(&game, s, ats)
+		if !ok && game.Status != Future {
+			continue
+		}
+
+		resultsRow := ResultsRow{
+			Time:       time,
+			TeamV:      game.TeamV,
+			TeamH:      game.TeamH,
+			ScoreV:     game.ScoreV,
+			ScoreH:     game.ScoreH,
+			Status:     game.Status,
+			Pick:       s.Team,
+			Confidence: s.Confidence,
+			Winner:     score.Winner,
+			Points:     score.Points,
+			Line:       game.line(season.Year, ats),
+		}
+
+		switch game.Status {
+		case Future:
+			future = append(future, resultsRow)
+		case InProgress:
+			inProgress = append(inProgress, resultsRow)
+		case Finished:
+			finished = append(finished, resultsRow)
+		}
+	}
+
+	return finished, inProgress, future
+}
+
+/**********************************************************/
+
+/* How a pick did */
+type PickScore struct {
+	Points int
+	Winner string // the team ahead or that won, "tie" if even
+	Good   bool   // picked the team ahead or that won
+	Push   bool   // finished even against the spread
+}
+
+/* The points for pick s in game.  The stored Points, the results
+ * page and the analyze page all score with this so they agree.
+ * ok is false until the game has started and has a score.  A game
+ * that finished even is scored by options.TieScoring, see tiePoints().
+ * Against the spread, ats, the winner is the team that covered the
+ * spread and even is a push, see spread.go. */
+func scorePick(game *Game, s Selection, ats bool) (score PickScore, ok bool) {
+	score.Winner = "tie"
+	if game.Status != InProgress && game.Status != Finished {
+		return score, false
+	}
+
+	scoreV, err := strconv.Atoi(game.ScoreV)
+	if err != nil {
+		return score, false
+	}
+	scoreH, err := strconv.Atoi(game.ScoreH)
+	if err != nil {
+		return score, false
+	}
+
+	/* in half points, for the half point spreads */
+	margin := 2 * (scoreH - scoreV)
+	if ats {
+		margin += int(math.Round(2 * game.Spread))
+		score.Winner = "push"
+	}
+	even := score.Winner
+
+	switch {
+	case margin > 0:
+		score.Winner = game.TeamH
+	case margin < 0:
+		score.Winner = game.TeamV
+	}
+
+	switch {
+	case s.Team == score.Winner:
+		score.Points = s.Confidence
+		score.Good = true
+	case score.Winner == even && game.Status == Finished:
+		score.Points = tiePoints(s.Confidence)
+		score.Push = ats
+	}
+
+	return score, true
+}
+
+/* options.TieScoring, what a pick in a tied game is worth:
+ *
+ *   "zero"  nothing (default)
+ *   "half"  half the confidence, rounded up
+ *   "full"  the confidence, as if the team won */
+func tiePoints(confidence int) int {
+	switch options.TieScoring {
+	case "half":
+		return (confidence + 1) / 2
+	case "full":
+		return confidence
+	}
+	return 0
+}
+
+func checkPoolOptions(o Options) error {
+	switch o.TieScoring {
+	case "", "zero", "half", "full":
+	default:
+		return fmt.Errorf("unknown TieScoring %q", o.TieScoring)
+	}
+
+	if err := checkStandingsRules(o.Standings); err != nil {
+		return err
+	}
+
+	if o.SpreadFreeze != "" {
+		if _, err := time.ParseDuration(o.SpreadFreeze); err != nil {
+			return fmt.Errorf("SpreadFreeze: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+/* The stored points and the results page agree for every tie setting */
+func TestTieScoring(t *testing.T) {
+	inProgress := Game{TeamV: "NYJ", TeamH: "NYG", ScoreV: "7", ScoreH: "7", Time: "Q3", Day: *NewDate(time.Now()), Status: InProgress}
+	newTestStore(t, 2021, []Game{finalGame("CHI", "GB", 20, 20, 0), inProgress, finalGame("DAL", "PHI", 3, 10, 0)})
+
+	u := addTestUser("fred")
+	u.UserWeeks[0].Selections = []Selection{{Team: "GB", Confidence: 5}, {Team: "NYJ", Confidence: 4}, {Team: "PHI", Confidence: 2}}
+
+	for mode, want := range map[string]int{"": 2, "zero": 2, "half": 5, "full": 7} {
+		options.TieScoring = mode
+		if err := checkPoolOptions(options); err != nil {
+			t.Error(err)
+		}
+		updateUserScoresWeekIndex(0)
+		finished, inProgress, _ := weekResults(&store.season, u.UserWeeks, 0, false)
+		shown := 0
+		for _, row := range append(finished, inProgress...) {
+			shown += row.Points
+		}
+		if u.UserWeeks[0].Points != want || shown != want || u.UserWeeks[0].GoodPicks != 1 {
+			t.Error(mode, "expected", want, "points, stored", u.UserWeeks[0].Points, "shown", shown,
+				"good picks", u.UserWeeks[0].GoodPicks)
+		}
+		if finished[0].Winner != "tie" {
+			t.Error(mode, "winner of a tie is", finished[0].Winner)
+		}
+	}
+
+	if checkPoolOptions(Options{TieScoring: "double"}) == nil {
+		t.Error("unknown pool options accepted")
+	}
+}
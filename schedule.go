@@ -0,0 +1,451 @@
+package main
+
+/* Where the schedule and results come from.
+ *
+ * options.ScheduleFormat picks the ScheduleSource used by both
+ * getSchedule() and updateGames():
+ *
+ *   "html"  the schedule page scraped with gameSchPageIterator (default)
+ *   "json"  a scoreboard feed,
+ *             {"games": [{"visitor": "Bears", "home": "Packers",
+ *                         "start": "2021-09-12T13:00:00-04:00",
+ *                         "status": "final",
+ *                         "visitorScore": 21, "homeScore": 7}]}
+ *           status is "scheduled", "in progress" or "final"
+ *   "csv"   a header line naming the columns date (2021-09-12), time,
+ *           visitor, home and, optionally, visitor score and home
+ *           score.  time is as on the schedule page, 1:00 PM or FINAL
+ *   "ical"  an iCalendar file with an event per game, the summary is
+ *           "Bears at Packers" or "Bears @ Packers".  A summary with
+ *           scores, "Bears 21 at Packers 7", is a finished game
+ *
+ * Teams can be named any way the registry knows, see teams.go, and
+ * readSchedule() replaces the names with the team IDs.  When the
+ * schedule is read from files, the week's file name is ScheduleUrl,
+ * the week number and the source's Ext(). */
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ScheduleSource interface {
+	Games(r io.Reader) ([]Game, error)
+	Ext() string
+}
+
+var scheduleSource ScheduleSource = htmlSchedule{}
+
+/* There is no schedule for the week, its file or page is not there
+ * or has no games.  Any other error may go away on the next try. */
+var errNoSchedule = errors.New("no schedule")
+
+/**********************************************************/
+
+func newScheduleSource(o Options) (ScheduleSource, error) {
+	switch o.ScheduleFormat {
+	case "", "html":
+		return htmlSchedule{}, nil
+	case "json":
+		return jsonSchedule{}, nil
+	case "csv":
+		return csvSchedule{}, nil
+	case "ical":
+		return icalSchedule{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown ScheduleFormat %q", o.ScheduleFormat)
+}
+
+/* Reads the games for season year from url with scheduleSource,
+ * from the web if fromWeb, otherwise url is a file name */
+func readSchedule(url string, fromWeb bool, year int) ([]Game, error) {
+	var r io.ReadCloser
+	if fromWeb {
+		resp, err := http.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusNotFound {
+				return nil, fmt.Errorf("%s: %w", url, errNoSchedule)
+			}
+			return nil, fmt.Errorf("%s: %s", url, resp.Status)
+		}
+		r = resp.Body
+	} else {
+		file, err := os.Open(url) // For read access.
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s: %w", url, errNoSchedule)
+		}
+		if err != nil {
+			return nil, err
+		}
+		r = file
+	}
+	defer r.Close()
+
+	games, err := scheduleSource.Games(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := resolveGames(games, year); err != nil {
+		return nil, fmt.Errorf("%s: %v", url, err)
+	}
+	return games, nil
+}
+
+/* The status of a game from the time the schedule shows for it */
+func timeStatus(timeStr string) GameStatus {
+	switch {
+	case strings.Contains(timeStr, "FINAL") || strings.Contains(timeStr, "F/OT"):
+		return Finished
+	case strings.Contains(timeStr, "AM") || strings.Contains(timeStr, "PM"):
+		return Future
+	}
+	return InProgress
+}
+
+/**********************************************************/
+
+type htmlSchedule struct{}
+
+func (htmlSchedule) Ext() string { return ".html" }
+
+func (htmlSchedule) Games(r io.Reader) ([]Game, error) {
+	iter := gameSchPageIterator{}
+	iter.p.Init(r)
+
+	games := make([]Game, 0, 16)
+	for iter.Next() {
+		games = append(games, iter.game)
+	}
+	return games, nil
+}
+
+type gameSchPageIterator struct {
+	p      ParseHTML
+	game   Game
+	dayStr string
+}
+
+func (iter *gameSchPageIterator) Next() bool {
+	var timeStr string
+	var teamHStr string
+	var teamVStr string
+	var scoreVStr string
+	var scoreHStr string
+	var b bool
+
+	if iter.p.SeekTag("divider", "left") == false {
+		return false
+	}
+
+	if strings.Compare("divider", iter.p.Tok.Attr[0].Val) == 0 {
+		// section for games on this day
+		iter.dayStr = iter.p.GetText()
+
+		// advances to game date which will be same as iter.dayStr
+		iter.p.SeekTag("left")
+	}
+
+	iter.p.SeekTag("center", "right")
+
+	if strings.Compare("right", iter.p.Tok.Attr[0].Val) == 0 {
+		// Game time
+		timeStr = iter.p.GetText()
+	} else {
+		// center tag.
+		// <th class="center" style="width:10%;">FINAL</th></tr>
+		timeStr = iter.p.GetText()
+	}
+
+	scoreVStr = ""
+	scoreHStr = ""
+
+	iter.p.SeekTag("left")
+	teamVStr = iter.p.GetText()
+
+	if strings.Contains(timeStr, "FINAL") || strings.Contains(timeStr, "F/OT") {
+		scoreVStr, b = iter.p.SeekBoldText()
+		if !b {
+			fmt.Println("SeekBoldText() failed after teamVStr", teamVStr)
+			return false
+		}
+	}
+
+	iter.p.SeekTag("left")
+	teamHStr = iter.p.GetText()
+
+	if strings.Contains(timeStr, "FINAL") || strings.Contains(timeStr, "F/OT") {
+		scoreHStr, b = iter.p.SeekBoldText()
+		if !b {
+			fmt.Println("SeekBoldText() failed after teamHStr", teamHStr)
+			return false
+		}
+	}
+
+	log.Println(teamVStr, scoreVStr, "vs", teamHStr, scoreHStr, "on", iter.dayStr, " ", timeStr)
+
+	var day Date
+	day.Set(iter.dayStr)
+
+	iter.game = Game{
+		TeamV:  teamVStr,
+		TeamH:  teamHStr,
+		ScoreV: scoreVStr,
+		ScoreH: scoreHStr,
+		Day:    day,
+		Time:   timeStr,
+		Status: timeStatus(timeStr),
+	}
+
+	return true
+}
+
+/**********************************************************/
+
+type jsonSchedule struct{}
+
+func (jsonSchedule) Ext() string { return ".json" }
+
+type jsonScoreboard struct {
+	Games []struct {
+		Visitor      string
+		Home         string
+		Start        time.Time
+		Status       string
+		VisitorScore *int
+		HomeScore    *int
+	}
+}
+
+func (jsonSchedule) Games(r io.Reader) ([]Game, error) {
+	var board jsonScoreboard
+	if err := json.NewDecoder(r).Decode(&board); err != nil {
+		return nil, err
+	}
+
+	games := make([]Game, 0, len(board.Games))
+	for _, g := range board.Games {
+		start := g.Start.In(timeZone)
+		game := Game{
+			TeamV: g.Visitor,
+			TeamH: g.Home,
+			Day:   *NewDate(start),
+		}
+
+		switch strings.ToLower(g.Status) {
+		case "", "scheduled":
+			game.Status = Future
+			game.Time = start.Format("3:04 PM")
+		case "in progress":
+			game.Status = InProgress
+			game.Time = "in progress"
+		case "final":
+			game.Status = Finished
+			game.Time = "FINAL"
+		default:
+			return nil, fmt.Errorf("%s at %s: unknown status %q", g.Visitor, g.Home, g.Status)
+		}
+
+		if game.Status != Future {
+			if g.VisitorScore == nil || g.HomeScore == nil {
+				return nil, fmt.Errorf("%s at %s: no score", g.Visitor, g.Home)
+			}
+			game.ScoreV = strconv.Itoa(*g.VisitorScore)
+			game.ScoreH = strconv.Itoa(*g.HomeScore)
+		}
+
+		log.Println(game.TeamV, game.ScoreV, "vs", game.TeamH, game.ScoreH, "on", game.Day.Format("Mon Jan 2"), " ", game.Time)
+		games = append(games, game)
+	}
+	return games, nil
+}
+
+/**********************************************************/
+
+type csvSchedule struct{}
+
+func (csvSchedule) Ext() string { return ".csv" }
+
+func (csvSchedule) Games(r io.Reader) ([]Game, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	column := make(map[string]int)
+	for i, name := range header {
+		column[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"date", "time", "visitor", "home"} {
+		if _, ok := column[name]; !ok {
+			return nil, fmt.Errorf("no %s column", name)
+		}
+	}
+
+	games := make([]Game, 0, 16)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		field := func(name string) string {
+			i, ok := column[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		day, err := time.ParseInLocation("2006-01-02", field("date"), timeZone)
+		if err != nil {
+			return nil, err
+		}
+
+		game := Game{
+			TeamV:  field("visitor"),
+			TeamH:  field("home"),
+			Day:    *NewDate(day),
+			Time:   field("time"),
+			Status: timeStatus(field("time")),
+		}
+		if game.Status == Finished {
+			game.ScoreV = field("visitor score")
+			game.ScoreH = field("home score")
+			if _, err := strconv.Atoi(game.ScoreV); err != nil {
+				return nil, fmt.Errorf("%s at %s: bad visitor score %q", game.TeamV, game.TeamH, game.ScoreV)
+			}
+			if _, err := strconv.Atoi(game.ScoreH); err != nil {
+				return nil, fmt.Errorf("%s at %s: bad home score %q", game.TeamV, game.TeamH, game.ScoreH)
+			}
+		}
+
+		log.Println(game.TeamV, game.ScoreV, "vs", game.TeamH, game.ScoreH, "on", game.Day.Format("Mon Jan 2"), " ", game.Time)
+		games = append(games, game)
+	}
+	return games, nil
+}
+
+/**********************************************************/
+
+type icalSchedule struct{}
+
+func (icalSchedule) Ext() string { return ".ics" }
+
+var icalMatchup = regexp.MustCompile(`^(.+?)\s+(?:at|@)\s+(.+)$`)
+var icalScore = regexp.MustCompile(`^(.+?)\s+(\d+)$`)
+
+/* The lines of an iCalendar file with the folded lines joined */
+func icalLines(r io.Reader) ([]string, error) {
+	lines := make([]string, 0, 64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+/* The start of an event from its DTSTART parameters and value */
+func icalTime(params []string, value string) (time.Time, error) {
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse("20060102T150405Z", value)
+	}
+
+	loc := timeZone
+	for _, param := range params {
+		if strings.HasPrefix(param, "TZID=") {
+			l, err := time.LoadLocation(strings.TrimPrefix(param, "TZID="))
+			if err != nil {
+				return time.Time{}, err
+			}
+			loc = l
+		}
+	}
+	return time.ParseInLocation("20060102T150405", value, loc)
+}
+
+func (icalSchedule) Games(r io.Reader) ([]Game, error) {
+	lines, err := icalLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	games := make([]Game, 0, 16)
+	var summary string
+	var start time.Time
+	inEvent := false
+	for _, line := range lines {
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		params := strings.Split(line[:i], ";")
+		name, value := strings.ToUpper(params[0]), line[i+1:]
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			inEvent = true
+			summary = ""
+			start = time.Time{}
+		case !inEvent:
+		case name == "SUMMARY":
+			summary = strings.TrimSpace(strings.ReplaceAll(value, "\\,", ","))
+		case name == "DTSTART":
+			start, err = icalTime(params[1:], value)
+			if err != nil {
+				return nil, fmt.Errorf("event %q: %s", summary, err.Error())
+			}
+		case name == "END" && value == "VEVENT":
+			inEvent = false
+			m := icalMatchup.FindStringSubmatch(summary)
+			if m == nil || start.IsZero() {
+				return nil, fmt.Errorf("event %q is not a game", summary)
+			}
+			start = start.In(timeZone)
+			game := Game{
+				Day:    *NewDate(start),
+				Time:   start.Format("3:04 PM"),
+				Status: Future,
+			}
+			v, h := icalScore.FindStringSubmatch(m[1]), icalScore.FindStringSubmatch(m[2])
+			if v != nil && h != nil {
+				game.TeamV, game.ScoreV = v[1], v[2]
+				game.TeamH, game.ScoreH = h[1], h[2]
+				game.Time = "FINAL"
+				game.Status = Finished
+			} else {
+				game.TeamV, game.TeamH = m[1], m[2]
+			}
+
+			log.Println(game.TeamV, game.ScoreV, "vs", game.TeamH, game.ScoreH, "on", game.Day.Format("Mon Jan 2"), " ", game.Time)
+			games = append(games, game)
+		}
+	}
+	return games, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+/* Every source gives the same games for the same week */
+func TestScheduleSources(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	defer func(saved *TeamRegistry) { teams = saved }(teams)
+	var err error
+	teams, err = loadTeams("teams.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feeds := map[string]string{
+		"json": `{"games": [
+			{"visitor": "Chicago Bears", "home": "Packers", "start": "2021-09-12T17:00:00Z",
+			 "status": "final", "visitorScore": 21, "homeScore": 7},
+			{"visitor": "Jets", "home": "Giants", "start": "2021-09-13T20:15:00-04:00"}]}`,
+		"csv": "date, time, visitor, home, visitor score, home score\n" +
+			"2021-09-12, FINAL, Chicago Bears, Packers, 21, 7\n" +
+			"2021-09-13, 8:15 PM, Jets, Giants,,\n",
+		"ical": "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART:20210912T170000Z\r\n" +
+			"SUMMARY:Chicago Bears 21 at Pack\r\n ers 7\r\nEND:VEVENT\r\n" +
+			"BEGIN:VEVENT\r\nDTSTART;TZID=America/Los_Angeles:20210913T171500\r\n" +
+			"SUMMARY:Jets @ Giants\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+	}
+
+	for format, feed := range feeds {
+		source, err := newScheduleSource(Options{ScheduleFormat: format})
+		if err != nil {
+			t.Fatal(format, err)
+		}
+		games, err := source.Games(strings.NewReader(feed))
+		if err == nil {
+			err = resolveGames(games, 2021)
+		}
+		if err != nil {
+			t.Error(format, err)
+			continue
+		}
+		if len(games) != 2 {
+			t.Error(format, "got", len(games), "games")
+			continue
+		}
+
+		g := games[0]
+		if g.TeamV != "CHI" || g.TeamH != "GB" || g.ScoreV != "21" || g.ScoreH != "7" ||
+			g.Status != Finished || g.Day != (Date{12, 9, 2021}) {
+			t.Error(format, "bad finished game", g)
+		}
+		g = games[1]
+		if g.TeamV != "NYJ" || g.TeamH != "NYG" || g.Status != Future || g.Time != "8:15 PM" ||
+			g.Day != (Date{13, 9, 2021}) {
+			t.Error(format, "bad future game", g)
+		}
+	}
+
+	if _, err := newScheduleSource(Options{ScheduleFormat: "xls"}); err == nil {
+		t.Error("unknown format accepted")
+	}
+	if _, err := (csvSchedule{}).Games(strings.NewReader("date,visitor,home\n")); err == nil {
+		t.Error("csv without a time column accepted")
+	}
+
+	/* only a missing week ends the season, not one we cannot read */
+	defer func(saved ScheduleSource) { scheduleSource = saved }(scheduleSource)
+	scheduleSource = csvSchedule{}
+	dir := t.TempDir()
+	if _, err := readSchedule(dir+"/week1.csv", false, 2021); !errors.Is(err, errNoSchedule) {
+		t.Error("missing week:", err)
+	}
+	ioutil.WriteFile(dir+"/week2.csv", []byte("date, time, visitor, home\n2021-09-12, 1:00 PM, Bears, Nobody\n"), 0600)
+	if _, err := readSchedule(dir+"/week2.csv", false, 2021); err == nil || errors.Is(err, errNoSchedule) {
+		t.Error("unknown team:", err)
+	}
+}
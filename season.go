@@ -0,0 +1,459 @@
+package main
+
+/* The schedule and the game results are saved to
+ * options.SeasonFile (default season<year>.xml) every time they
+ * change, and loaded from there at startup.  ScheduleUrl is only
+ * used to fill in weeks we do not have and to refresh the current
+ * week, see updateGames().
+ *
+ * options.Season is the year of the current season.  The
+ * season<year>.xml files of earlier seasons are loaded into
+ * store.archive and are never changed.  Each user's UserWeeks are
+ * for User.Season; when a new season starts the old weeks are moved
+ * to User.PastSeasons, see startSeason().
+ *
+ * The number of regular season weeks is options.Weeks, or the number
+ * in the saved season, or however many weeks ScheduleUrl has games
+ * for.  Users' weeks grow to match, see fitWeeks().
+ *
+ * options.Playoffs are more weeks after the regular season, one for
+ * each round, each with its own label and schedule URL.  A round
+ * that is not scheduled yet is an empty week until updateGames()
+ * gets its games.  Playoff weeks count in the main standings if
+ * options.PlayoffStandings is "combined", otherwise they have their
+ * own leaderboard, see playoffStandings().  Regular weeks can have
+ * confidences up to 16, playoff weeks up to the number of games. */
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+/* Users saved before there were seasons played this one.
+ * The current season comes from options.Season or nflSeason(). */
+const defaultSeasonYear = 2020
+
+/* Most weeks we look for when going by the schedule */
+const maxScheduleWeeks = 25
+
+/* A user's weeks for a season that is over */
+type UserSeason struct {
+	Year      int `xml:"Year,attr"`
+	UserWeeks []UserWeek
+}
+
+/* How the season is written to the file */
+type seasonFile struct {
+	XMLName xml.Name `xml:"Season"`
+	Year    int      `xml:"Year,attr"`
+	Weeks   []Week   `xml:"Week"`
+}
+
+func seasonFileName(year int) string {
+	if options.SeasonFile != "" && year == store.season.Year {
+		return options.SeasonFile
+	}
+	return filepath.Join(options.ArchiveDir, fmt.Sprintf("season%d.xml", year))
+}
+
+/* The season being played on day now.  A season starts in September
+ * and its playoffs run into February, so until March it is still
+ * last year's; from March on we get ready for this year's. */
+func nflSeason(now time.Time) int {
+	if now.Month() < time.March {
+		return now.Year() - 1
+	}
+	return now.Year()
+}
+
+/**********************************************************/
+
+/* Rebuilds the parts of the week that are not saved:
+ * the team lookup and the first and last game days */
+func (w *Week) index() {
+	w.teamToGame = make(map[string]*Game)
+	w.weekStart = time.Time{}
+	w.weekEnd = time.Time{}
+
+	for i := range w.Games {
+		game := &w.Games[i]
+		w.teamToGame[game.TeamV] = game
+		w.teamToGame[game.TeamH] = game
+
+		day := game.Day.Time()
+		if w.weekStart.IsZero() || day.Before(w.weekStart) {
+			w.weekStart = day
+		}
+		if w.weekEnd.IsZero() || day.After(w.weekEnd) {
+			w.weekEnd = day
+		}
+	}
+}
+
+/**********************************************************/
+
+/* Caller must hold the store lock, at least for reading */
+func saveSeason() error {
+	sf := seasonFile{Year: store.season.Year, Weeks: store.season.Week}
+
+	b, err := xml.MarshalIndent(&sf, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	fileName := seasonFileName(store.season.Year)
+	if err := writeFileAtomic(fileName, b); err != nil {
+		return err
+	}
+	log.Println("saved season to", fileName)
+
+	return nil
+}
+
+func newSeason(year int, weeks int) *Season {
+	season := &Season{Year: year}
+	season.setWeeks(weeks)
+	return season
+}
+
+/* Grows or shrinks the season to n weeks */
+func (s *Season) setWeeks(n int) {
+	for len(s.Week) < n {
+		s.Week = append(s.Week, Week{Num: len(s.Week) + 1})
+	}
+	s.Week = s.Week[:n]
+
+	/* the weeks may have moved */
+	for i := range s.Week {
+		s.Week[i].index()
+	}
+}
+
+/* Lays the season out as regular weeks followed by a week for each
+ * playoff round, keeping the games we already have for each week */
+func (s *Season) layout(regular int, rounds []PlayoffRound) {
+	old := s.Week
+	s.Week = make([]Week, 0, regular+len(rounds))
+
+	for i := 0; i < regular; i++ {
+		w := Week{Num: i + 1}
+		for _, o := range old {
+			if !o.Playoff && o.Num == i+1 {
+				w = o
+				break
+			}
+		}
+		s.Week = append(s.Week, w)
+	}
+
+	for i, round := range rounds {
+		w := Week{}
+		for _, o := range old {
+			if o.Playoff && o.Label == round.Label {
+				w = o
+				break
+			}
+		}
+		w.Num = regular + i + 1
+		w.Label = round.Label
+		w.Playoff = true
+		s.Week = append(s.Week, w)
+	}
+
+	for i := range s.Week {
+		s.Week[i].index()
+	}
+}
+
+func (s *Season) regularWeeks() int {
+	n := 0
+	for _, w := range s.Week {
+		if !w.Playoff {
+			n++
+		}
+	}
+	return n
+}
+
+/* Whether any week has games */
+func (s *Season) scheduled() bool {
+	for _, w := range s.Week {
+		if len(w.Games) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+/* "Week 3", or the playoff round */
+func (w *Week) name() string {
+	if w.Label != "" {
+		return w.Label
+	}
+	return fmt.Sprintf("Week %d", w.Num)
+}
+
+/* Whether every game of the week is over */
+func (w *Week) finished() bool {
+	for _, game := range w.Games {
+		if game.Status != Finished {
+			return false
+		}
+	}
+	return len(w.Games) > 0
+}
+
+/* The highest confidence for a pick in the week */
+func (w *Week) maxConfidence() int {
+	if w.Playoff && len(w.Games) > 0 {
+		return len(w.Games)
+	}
+	return 16
+}
+
+/* Caller must hold the store lock, at least for reading.  Where the
+ * schedule for week index iw comes from, a URL if fromWeb, otherwise
+ * a file. */
+func weekUrl(iw int, fromWeb bool) string {
+	w := &store.season.Week[iw]
+	if w.Playoff {
+		for _, round := range options.Playoffs {
+			if round.Label == w.Label {
+				return round.Url
+			}
+		}
+	}
+
+	if fromWeb {
+		return fmt.Sprintf("%s%d", options.ScheduleUrl, w.Num)
+	}
+	return fmt.Sprintf("%s%d%s", options.ScheduleUrl, w.Num, scheduleSource.Ext())
+}
+
+func readSeasonFile(fileName string, year int) (*Season, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var sf seasonFile
+	if err := xml.Unmarshal(b, &sf); err != nil {
+		return nil, fmt.Errorf("%s: %v", fileName, err)
+	}
+
+	if sf.Year != year {
+		return nil, fmt.Errorf("%s is for season %d, not %d", fileName, sf.Year, year)
+	}
+
+	weeks := 0
+	for _, w := range sf.Weeks {
+		if w.Num > weeks && w.Num <= maxScheduleWeeks {
+			weeks = w.Num
+		}
+	}
+
+	season := newSeason(year, weeks)
+	for _, w := range sf.Weeks {
+		iw := w.Num - 1
+		if iw < 0 || iw >= len(season.Week) {
+			log.Println(fileName, ": ignoring week", w.Num)
+			continue
+		}
+		season.Week[iw] = w
+		for ig := range w.Games {
+			/* saved before the team registry, with names */
+			g := &season.Week[iw].Games[ig]
+			if v, err := teams.resolve(g.TeamV, year); err == nil {
+				g.TeamV = v
+			}
+			if h, err := teams.resolve(g.TeamH, year); err == nil {
+				g.TeamH = h
+			}
+		}
+		if t, err := teams.resolve(w.Tiebreaker, year); err == nil {
+			season.Week[iw].Tiebreaker = t
+		}
+		season.Week[iw].index()
+	}
+
+	return season, nil
+}
+
+/* Caller must hold the store lock */
+func loadSeason() error {
+	fileName := seasonFileName(store.season.Year)
+
+	season, err := readSeasonFile(fileName, store.season.Year)
+	if err != nil {
+		return err
+	}
+	store.season.Week = season.Week
+	log.Println("loaded", len(season.Week), "weeks from", fileName)
+
+	return nil
+}
+
+/* Caller must hold the store lock.  Loads every earlier season
+ * we have a file for or that a user played in. */
+func loadArchive() {
+	store.archive = make(map[int]*Season)
+
+	years := make(map[int]bool)
+	names, _ := filepath.Glob(filepath.Join(options.ArchiveDir, "season*.xml"))
+	for _, name := range names {
+		var year int
+		if _, err := fmt.Sscanf(filepath.Base(name), "season%d.xml", &year); err == nil {
+			years[year] = true
+		}
+	}
+	for _, u := range store.users {
+		for _, ps := range u.PastSeasons {
+			years[ps.Year] = true
+		}
+	}
+
+	for year := range years {
+		if year == store.season.Year {
+			continue
+		}
+
+		season, err := readSeasonFile(seasonFileName(year), year)
+		if err != nil {
+			/* we still have the users' points for the standings */
+			log.Println("archive:", err.Error())
+			weeks := 0
+			for _, u := range store.users {
+				if len(u.weeks(year)) > weeks {
+					weeks = len(u.weeks(year))
+				}
+			}
+			season = newSeason(year, weeks)
+		}
+		store.archive[year] = season
+		log.Println("archived season", year)
+	}
+}
+
+/* Caller must hold the store lock, at least for reading.
+ * The current season or one from the archive, nil if we
+ * do not have it. */
+func seasonFor(year int) *Season {
+	if year == store.season.Year {
+		return &store.season
+	}
+	return store.archive[year]
+}
+
+/* Caller must hold the store lock, at least for reading.
+ * The years of the seasons we have, newest first. */
+func seasonYears() []int {
+	years := []int{store.season.Year}
+	for year := range store.archive {
+		years = append(years, year)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(years)))
+	return years
+}
+
+/**********************************************************/
+
+func newUserWeeks(n int) []UserWeek {
+	weeks := make([]UserWeek, n)
+	for i := range weeks {
+		weeks[i].Num = i + 1
+	}
+	return weeks
+}
+
+func played(weeks []UserWeek) bool {
+	for _, w := range weeks {
+		if w.Selections != nil {
+			return true
+		}
+	}
+	return false
+}
+
+/* Caller must hold the store lock.  If the user's weeks are for an
+ * earlier season, moves them to PastSeasons and starts the user on
+ * year.  Returns true if the user changed and needs to be saved.
+ * Call fitWeeks() once the season's length is known. */
+func (u *User) startSeason(year int) bool {
+	changed := false
+
+	if u.Season == 0 {
+		u.Season = defaultSeasonYear
+		changed = true
+	}
+
+	if u.Season != year {
+		log.Println("user", u.Email, "season", u.Season, "is over, starting", year)
+		if played(u.UserWeeks) {
+			u.PastSeasons = append(u.PastSeasons, UserSeason{Year: u.Season, UserWeeks: u.UserWeeks})
+		}
+		u.Season = year
+		u.UserWeeks = nil
+
+		/* going back to a season we have already archived */
+		for i, ps := range u.PastSeasons {
+			if ps.Year == year {
+				u.UserWeeks = ps.UserWeeks
+				u.PastSeasons = append(u.PastSeasons[:i], u.PastSeasons[i+1:]...)
+				break
+			}
+		}
+
+		sort.Slice(u.PastSeasons, func(i, j int) bool { return u.PastSeasons[i].Year > u.PastSeasons[j].Year })
+		changed = true
+	}
+
+	return changed
+}
+
+/* Caller must hold the store lock.  Makes the user's weeks match a
+ * season of n weeks.  Weeks past the end of the season are dropped
+ * only if they have no picks, so the user's weeks are never shorter
+ * than the season but may be longer.  Returns true if the user
+ * changed and needs to be saved. */
+func (u *User) fitWeeks(n int) bool {
+	changed := u.growWeeks(n)
+
+	for len(u.UserWeeks) > n && u.UserWeeks[len(u.UserWeeks)-1].Selections == nil {
+		u.UserWeeks = u.UserWeeks[:len(u.UserWeeks)-1]
+		changed = true
+	}
+	if len(u.UserWeeks) > n {
+		log.Println("user", u.Email, "has picks past week", n, "keeping", len(u.UserWeeks), "weeks")
+	}
+
+	return changed
+}
+
+/* Caller must hold the store lock.  Adds weeks until the user has
+ * at least n, returns true if any were added. */
+func (u *User) growWeeks(n int) bool {
+	changed := false
+	for len(u.UserWeeks) < n {
+		u.UserWeeks = append(u.UserWeeks, UserWeek{Num: len(u.UserWeeks) + 1})
+		changed = true
+	}
+	return changed
+}
+
+/* The user's weeks for the season, nil if the user did not play */
+func (u *User) weeks(year int) []UserWeek {
+	if year == u.Season {
+		return u.UserWeeks
+	}
+	for _, ps := range u.PastSeasons {
+		if ps.Year == year {
+			return ps.UserWeeks
+		}
+	}
+	return nil
+}
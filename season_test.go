@@ -0,0 +1,262 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStartSeason(t *testing.T) {
+	newTestStore(t, 2022, make([][]Game, 18)...)
+
+	/* a user file from before there were seasons */
+	u := &User{Email: "fred@foo.com", Name: "fred", UserWeeks: newUserWeeks(17)}
+	u.UserWeeks[0].Selections = []Selection{{Team: "CHI", Confidence: 16}}
+	u.UserWeeks[0].Points = 16
+
+	if !u.startSeason(2021) || !u.fitWeeks(18) {
+		t.Fatal("expected the user to change")
+	}
+	if u.Season != 2021 || len(u.UserWeeks) != 18 || u.UserWeeks[0].Selections != nil {
+		t.Error("2021 not started", u.Season, u.UserWeeks[0])
+	}
+	if len(u.PastSeasons) != 1 || u.PastSeasons[0].Year != defaultSeasonYear {
+		t.Fatal("2020 not archived", u.PastSeasons)
+	}
+	if w := u.weeks(defaultSeasonYear); w == nil || w[0].Points != 16 {
+		t.Error("wrong weeks for 2020", w)
+	}
+
+	if u.startSeason(2021) || u.fitWeeks(18) {
+		t.Error("starting the same season again changed the user")
+	}
+
+	/* a shorter season only drops weeks with no picks */
+	u.UserWeeks[16].Selections = []Selection{{Team: "NYJ", Confidence: 1}}
+	u.fitWeeks(15)
+	if len(u.UserWeeks) != 17 {
+		t.Error("expected 17 weeks, got", len(u.UserWeeks))
+	}
+	u.UserWeeks[16].Selections = nil
+	u.fitWeeks(15)
+	if len(u.UserWeeks) != 15 {
+		t.Error("expected 15 weeks, got", len(u.UserWeeks))
+	}
+
+	/* nothing played in 2021, so there is nothing to archive */
+	u.startSeason(2022)
+	if len(u.PastSeasons) != 1 || u.weeks(2021) != nil {
+		t.Error("empty season archived", u.PastSeasons)
+	}
+
+	/* standings for the archived season */
+	store.users[u.Email] = u
+	store.archive = map[int]*Season{defaultSeasonYear: newSeason(defaultSeasonYear, 17)}
+
+	standings := seasonStandings(defaultSeasonYear, nil)
+	if len(standings) != 1 || standings[0].Total != 16 || standings[0].WeeksPlayed != 1 {
+		t.Error("wrong standings for 2020", standings)
+	}
+	if years := seasonYears(); len(years) != 2 || years[0] != 2022 || years[1] != defaultSeasonYear {
+		t.Error("wrong season years", years)
+	}
+}
+
+func TestPlayoffs(t *testing.T) {
+	newTestStore(t, 2022, nil, []Game{finalGame("CHI", "GB", 7, 3, 3)})
+	options.Playoffs = []PlayoffRound{{Label: "Wild Card", Url: "wc.html"}, {Label: "Super Bowl", Url: "sb.html"}}
+	options.ScheduleUrl = "week"
+
+	store.season.layout(store.season.regularWeeks(), options.Playoffs)
+	if len(store.season.Week) != 4 || len(store.season.Week[1].Games) != 1 {
+		t.Fatal("bad layout", store.season.Week)
+	}
+	wc := &store.season.Week[2]
+	if !wc.Playoff || wc.name() != "Wild Card" || wc.Num != 3 || weekUrl(2, false) != "wc.html" || weekUrl(1, false) != "week2.html" {
+		t.Error("bad wild card week", wc.Num, wc.name(), weekUrl(2, false))
+	}
+
+	/* regular season is over and the wild card is not scheduled */
+	updateWeekIndex()
+	if store.iWeek != 2 || store.seasonEnded {
+		t.Error("expected to wait for the wild card, week index", store.iWeek, store.seasonEnded)
+	}
+
+	/* the wild card schedule shows up */
+	updateWeekGames(2, []Game{futureGame("NYJ", "NYG", 2), futureGame("DET", "LAR", 2)})
+	if len(wc.Games) != 2 || wc.maxConfidence() != 2 || store.season.Week[0].maxConfidence() != 16 {
+		t.Error("wild card games not added", wc.Games)
+	}
+
+	u := addTestUser("fred")
+	u.UserWeeks[1].Selections = []Selection{{Team: "CHI", Confidence: 16}}
+	u.UserWeeks[1].Points = 16
+	u.UserWeeks[2].Selections = []Selection{{Team: "NYJ", Confidence: 2}}
+	u.UserWeeks[2].Points = 2
+	store.iWeek = 3
+	store.seasonEnded = false
+
+	if s := seasonStandings(2022, nil); s[0].Total != 16 {
+		t.Error("playoffs in the main standings", s)
+	}
+	if s := playoffStandings(2022, nil); len(s) != 1 || s[0].Total != 2 {
+		t.Error("wrong playoff standings", s)
+	}
+
+	options.PlayoffStandings = "combined"
+	if s := seasonStandings(2022, nil); s[0].Total != 18 {
+		t.Error("playoffs not combined", s)
+	}
+	if s := playoffStandings(2022, nil); s != nil {
+		t.Error("playoff standings when combined", s)
+	}
+}
+
+func TestNflSeason(t *testing.T) {
+	for _, c := range []struct {
+		day  string
+		year int
+	}{
+		{"2023-09-10", 2023},
+		{"2024-01-14", 2023}, /* wild card weekend */
+		{"2024-02-11", 2023}, /* Super Bowl */
+		{"2024-03-01", 2024},
+		{"2024-12-31", 2024},
+	} {
+		day, _ := time.Parse("2006-01-02", c.day)
+		if year := nflSeason(day); year != c.year {
+			t.Error(c.day, "expected season", c.year, "got", year)
+		}
+	}
+}
+
+func TestArchiveDir(t *testing.T) {
+	newTestStore(t, 2021, []Game{finalGame("CHI", "GB", 21, 7, 100)})
+	options.ArchiveDir = filepath.Join(t.TempDir(), "seasons")
+	os.Mkdir(options.ArchiveDir, 0700)
+
+	if err := saveSeason(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(options.ArchiveDir, "season2021.xml")); err != nil {
+		t.Fatal("season not saved to the archive directory:", err)
+	}
+
+	store.season = *newSeason(2022, 18)
+	loadArchive()
+	if s := store.archive[2021]; s == nil || len(s.Week) != 1 || s.Week[0].Games[0].TeamV != "CHI" {
+		t.Error("2021 not loaded from the archive directory", store.archive)
+	}
+}
+
+func TestSaveLoadSeason(t *testing.T) {
+	override := finalGame("CHI", "GB", 21, 7, 8)
+	override.Override = true
+	spread := futureGame("NYJ", "NYG", 1)
+	spread.Spread = -3.5
+	newTestStore(t, 2022, []Game{override, spread}, []Game{futureGame("DET", "LAR", 8)})
+	store.season.Week[1].Playoff = true
+	store.season.Week[1].Label = "Wild Card"
+	store.season.Week[1].Tiebreaker = "DET"
+	store.season.Week[0].Reminded = true
+
+	if err := saveSeason(); err != nil {
+		t.Fatal(err)
+	}
+	saved := store.season
+	store.season = *newSeason(2022, 0)
+	if err := loadSeason(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(store.season.Week) != 2 {
+		t.Fatal("expected 2 weeks, got", len(store.season.Week))
+	}
+	for iw, w := range store.season.Week {
+		s := saved.Week[iw]
+		if w.Num != s.Num || w.Label != s.Label || w.Playoff != s.Playoff || w.Tiebreaker != s.Tiebreaker || w.Reminded != s.Reminded || len(w.Games) != len(s.Games) {
+			t.Fatal("week", iw, "not loaded as saved", w)
+		}
+		for ig, g := range w.Games {
+			if g != s.Games[ig] {
+				t.Error("week", iw, "game", ig, "loaded as", g, "saved as", s.Games[ig])
+			}
+		}
+	}
+	if wc := store.season.Week[1]; wc.name() != "Wild Card" || wc.teamToGame["LAR"] == nil {
+		t.Error("wild card week not indexed", wc.name())
+	}
+}
+
+/* Starting while the schedule can not be read, with no saved season */
+func TestScheduleDown(t *testing.T) {
+	newTestStore(t, 2022)
+	defer func(saved ScheduleSource) { scheduleSource = saved }(scheduleSource)
+	scheduleSource = csvSchedule{}
+
+	var mu sync.Mutex
+	up := make(map[string]bool)
+	feeds := map[string]string{
+		"/week1": "date, time, visitor, home, visitor score, home score\n" +
+			time.Now().AddDate(0, 0, -10).Format("2006-01-02") + ", FINAL, Bears, Packers, 21, 7\n",
+		"/week2": "date, time, visitor, home, visitor score, home score\n" +
+			time.Now().AddDate(0, 0, 3).Format("2006-01-02") + ", 1:00 PM, Jets, Giants,,\n",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		feed, ok := feeds[r.URL.Path]
+		switch {
+		case !up[r.URL.Path] && ok:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case !ok:
+			http.NotFound(w, r)
+		default:
+			io.WriteString(w, feed)
+		}
+	}))
+	defer srv.Close()
+	options.ScheduleUrl = srv.URL + "/week"
+	options.ScheduleFromWeb = true
+	options.UpdateFromWeb = true
+
+	/* nothing to start with, with or without playoffs */
+	for _, playoffs := range [][]PlayoffRound{nil, {{Label: "Wild Card", Url: srv.URL + "/wildcard"}}} {
+		options.Playoffs = playoffs
+		store.season = *newSeason(2022, 0)
+		if _, err := loadSchedule(); err == nil {
+			t.Error("started with no schedule, playoffs", playoffs)
+		}
+		if _, err := os.Stat(seasonFileName(2022)); err == nil {
+			t.Error("season saved with no schedule")
+		}
+	}
+
+	/* week 2 is still down, it is filled in when it comes up */
+	options.Playoffs = nil
+	store.season = *newSeason(2022, 0)
+	mu.Lock()
+	up["/week1"] = true
+	mu.Unlock()
+	probed, err := loadSchedule()
+	if err != nil || !probed || len(store.season.Week) != 2 || len(store.season.Week[1].Games) != 0 {
+		t.Fatal("expected week 2 to be empty", err, probed, store.season.Week)
+	}
+	updateWeekIndex()
+	if store.iWeek != 0 || !store.seasonEnded {
+		t.Error("expected the season to be over after week 1", store.iWeek, store.seasonEnded)
+	}
+
+	mu.Lock()
+	up["/week2"] = true
+	mu.Unlock()
+	fillEmptyWeeks()
+	if len(store.season.Week[1].Games) != 1 || store.iWeek != 1 || store.seasonEnded {
+		t.Error("week 2 not filled in", store.season.Week[1].Games, store.iWeek, store.seasonEnded)
+	}
+}
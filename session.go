@@ -0,0 +1,133 @@
+package main
+
+/* Login sessions.
+ *
+ * The "session" cookie holds a token made by New() (see users.go)
+ * from "<email> <session generation>" and an expiration time, signed
+ * with the server's session secret.  The secret is
+ * options.SessionSecret and is kept separate from
+ * options.PwRecoverSecret so that a password reset token can never
+ * be used as a session.
+ *
+ * Bumping User.SessionGen invalidates every session the user has. */
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const sessionCookieName = "session"
+
+/* How long a login lasts */
+const sessionDuration = 30 * 24 * time.Hour
+
+/* Longest email we will accept in a session cookie, see MinLength */
+const maxSessionLoginLength = 256
+
+var sessionSecret []byte
+
+/**********************************************************/
+
+func initSessions() {
+	if options.SessionSecret != "" {
+		sessionSecret = []byte(options.SessionSecret)
+		return
+	}
+
+	/* No secret configured, make one up.  Everybody will
+	 * have to log in again when the server restarts. */
+	log.Println("SessionSecret not set in options, using a random secret")
+	sessionSecret = make([]byte, 32)
+	if _, err := rand.Read(sessionSecret); err != nil {
+		log.Panic("cannot create session secret: ", err)
+	}
+}
+
+/**********************************************************/
+
+func setSession(w http.ResponseWriter, user *User) {
+	expires := time.Now().Add(sessionDuration)
+	login := fmt.Sprintf("%s %d", user.Email, user.SessionGen)
+	cookie := &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    New(login, expires, sessionSecret),
+		Path:     "/",
+		Expires:  expires,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	http.SetCookie(w, cookie)
+}
+
+func clearSession(w http.ResponseWriter) {
+	cookie := &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	http.SetCookie(w, cookie)
+}
+
+/* Returns the email and session generation from the session
+ * cookie, or "" if the cookie is missing, expired or not signed
+ * by us */
+func getSessionLogin(r *http.Request) (email string, gen int) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return "", 0
+	}
+
+	if len(cookie.Value) > maxSessionLoginLength+MinLength {
+		log.Println("session cookie too long from", r.RemoteAddr)
+		return "", 0
+	}
+
+	login := Login(cookie.Value, sessionSecret)
+	fields := strings.Fields(login)
+	if len(fields) != 2 {
+		return "", 0
+	}
+
+	gen, err = strconv.Atoi(fields[1])
+	if err != nil {
+		return "", 0
+	}
+
+	return fields[0], gen
+}
+
+/* Returns the logged in user, or nil if there is none */
+func getSessionUser(r *http.Request) *User {
+	email, gen := getSessionLogin(r)
+	if email == "" {
+		return nil
+	}
+
+	user, ok := store.users[email]
+	if !ok {
+		log.Println("session for unknown user", email)
+		return nil
+	}
+
+	if gen != user.SessionGen {
+		log.Println("stale session for", email, "generation", gen, "current", user.SessionGen)
+		return nil
+	}
+
+	if user.Disabled {
+		log.Println("session for disabled user", email)
+		return nil
+	}
+
+	return user
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+	sessionSecret = []byte("test secret")
+	store.users = map[string]*User{"fred@foo.com": &User{Email: "fred@foo.com"}}
+
+	w := httptest.NewRecorder()
+	setSession(w, store.users["fred@foo.com"])
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatal("expected one cookie, got", len(cookies))
+	}
+
+	r := httptest.NewRequest("GET", "/user", nil)
+	r.AddCookie(cookies[0])
+	if user := getSessionUser(r); user == nil || user.Email != "fred@foo.com" {
+		t.Error("session did not resolve to fred@foo.com")
+	}
+
+	/* after the session generation changes the cookie is no good */
+	store.users["fred@foo.com"].SessionGen++
+	if user := getSessionUser(r); user != nil {
+		t.Error("stale session accepted for", user.Email)
+	}
+
+	/* the old style cookie with the plain email must not work */
+	r = httptest.NewRequest("GET", "/user", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: "fred@foo.com"})
+	if user := getSessionUser(r); user != nil {
+		t.Error("unsigned cookie accepted for", user.Email)
+	}
+
+	/* signed with some other secret */
+	r = httptest.NewRequest("GET", "/user", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: NewSinceNow("fred@foo.com 1", sessionDuration, []byte("other"))})
+	if user := getSessionUser(r); user != nil {
+		t.Error("cookie with wrong signature accepted for", user.Email)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+/* Against the spread, leagues with the ats PoolMode setting.
+ *
+ * Each game has a point spread, Game.Spread, the points the home
+ * team is given: -3.5 when the home team is favored by 3.5.  A pick
+ * wins only if its team covers, the home score plus the spread beats
+ * the visitor's score or the other way around.  When they come out
+ * even it is a push, scored like a tie by options.TieScoring, see
+ * scorePick().  Confidences work as in the confidence pool.
+ *
+ * The picks are the same ones the other leagues score.  The stored
+ * Points are for picking the winner, an ATS league rescores the
+ * picks against the spread, see atsWeeks().
+ *
+ * The spreads come from options.SpreadFile (default spreads.csv),
+ * read at startup and each time the games are updated, or an
+ * administrator enters them on the week's games page.  A game's
+ * spread is frozen options.SpreadFreeze (a duration like "24h",
+ * default 0) before kickoff, after that neither can change it.
+ *
+ * The file has a line for each game, teams named any way the
+ * registry knows, see teams.go:
+ *
+ *   week,visitor,home,spread
+ *   1,Bears,Packers,-3.5 */
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* More than any spread has been, to catch typos */
+const maxSpread = 40
+
+/* Caller must hold the store lock, at least for reading.
+ * The against the spread leagues the user is in. */
+func atsLeagues(user *User) []*League {
+	leagues := make([]*League, 0)
+	for _, l := range leaguesOf(user) {
+		if l.ats() {
+			leagues = append(leagues, l)
+		}
+	}
+	return leagues
+}
+
+/* Caller must hold the store lock, at least for reading.
+ * Whether any league picks against the spread. */
+func spreadsUsed() bool {
+	for _, l := range store.leagues {
+		if l.ats() {
+			return true
+		}
+	}
+	return false
+}
+
+/* Caller must hold the store lock, at least for reading.  The weeks
+ * with the picks scored against the spread. */
+func atsWeeks(season *Season, weeks []UserWeek) []UserWeek {
+	if weeks == nil {
+		return nil
+	}
+
+	scored := make([]UserWeek, len(weeks))
+	for iw := range weeks {
+		uw := weeks[iw]
+		uw.Points, uw.GoodPicks, uw.Pushes = 0, 0, 0
+		for _, s := range uw.Selections {
+			if season == nil || iw >= len(season.Week) {
+				break
+			}
+			game := season.Week[iw].teamToGame[s.Team]
+			if game == nil {
+				continue
+			}
+			if score, ok := scorePick(game, s, true); ok {
+				uw.Points += score.Points
+				if score.Good {
+					uw.GoodPicks++
+				}
+				if score.Push {
+					uw.Pushes++
+				}
+			}
+		}
+		scored[iw] = uw
+	}
+	return scored
+}
+
+/* options.SpreadFreeze, checked by checkPoolOptions() */
+func spreadFreeze() time.Duration {
+	d, _ := time.ParseDuration(options.SpreadFreeze)
+	return d
+}
+
+/* Whether the game's spread can no longer change */
+func (g *Game) spreadFrozen(now time.Time) bool {
+	if g.Status != Future {
+		return true
+	}
+	return now.After(g.Day.AddDayTime(g.Time).Add(-spreadFreeze()))
+}
+
+/* The spread the way the sports pages show it, "Packers -3.5" for
+ * the favorite, "pick" for an even game and "" if not ats */
+func (g *Game) line(year int, ats bool) string {
+	if !ats {
+		return ""
+	}
+	switch {
+	case g.Spread < 0:
+		return teams.name(g.TeamH, year) + " " + strconv.FormatFloat(g.Spread, 'f', -1, 64)
+	case g.Spread > 0:
+		return teams.name(g.TeamV, year) + " " + strconv.FormatFloat(-g.Spread, 'f', -1, 64)
+	}
+	return "pick"
+}
+
+/* Caller must hold the store lock.  Sets the game's spread
+ * unless it is frozen. */
+func setSpread(game *Game, spread float64, now time.Time) error {
+	if math.Abs(spread) > maxSpread || spread*2 != math.Trunc(spread*2) {
+		return fmt.Errorf("A spread of %v is not likely, use whole or half points up to %d", spread, maxSpread)
+	}
+	if game.Spread == spread {
+		return nil
+	}
+	if game.spreadFrozen(now) {
+		return fmt.Errorf("The spread for %s at %s is frozen", teams.name(game.TeamV, store.season.Year),
+			teams.name(game.TeamH, store.season.Year))
+	}
+
+	log.Println("spread", game.TeamV, "at", game.TeamH, "from", game.Spread, "to", spread)
+	game.Spread = spread
+	return nil
+}
+
+/**********************************************************/
+
+/* A line of the spread file */
+type spreadLine struct {
+	Num    int
+	TeamV  string
+	TeamH  string
+	Spread float64
+}
+
+func readSpreads(r io.Reader, year int) ([]spreadLine, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 4
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]spreadLine, 0, len(records))
+	for i, rec := range records {
+		if i == 0 && strings.EqualFold(rec[0], "week") {
+			continue
+		}
+
+		num, err := strconv.Atoi(rec[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad week %q", i+1, rec[0])
+		}
+		spread, err := strconv.ParseFloat(rec[3], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad spread %q", i+1, rec[3])
+		}
+		teamV, err := teams.resolve(rec[1], year)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		teamH, err := teams.resolve(rec[2], year)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		lines = append(lines, spreadLine{Num: num, TeamV: teamV, TeamH: teamH, Spread: spread})
+	}
+
+	return lines, nil
+}
+
+/* Caller must hold the store lock.  Sets the spreads from
+ * options.SpreadFile for the games that are not frozen yet,
+ * returns true if any changed.  The caller saves the season. */
+func loadSpreads() bool {
+	if !spreadsUsed() {
+		return false
+	}
+
+	fileName := options.SpreadFile
+	if fileName == "" {
+		fileName = "spreads.csv"
+	}
+	f, err := os.Open(fileName)
+	if err != nil {
+		log.Println("spreads:", err.Error())
+		return false
+	}
+	defer f.Close()
+
+	lines, err := readSpreads(f, store.season.Year)
+	if err != nil {
+		log.Println("spreads:", fileName, ":", err.Error())
+		return false
+	}
+
+	changed := false
+	now := time.Now()
+	for _, line := range lines {
+		var game *Game
+		for iw := range store.season.Week {
+			if store.season.Week[iw].Num == line.Num {
+				game = store.season.Week[iw].teamToGame[line.TeamV]
+				break
+			}
+		}
+		if game == nil || game.TeamH != line.TeamH {
+			log.Println("spreads: no game", line.TeamV, "at", line.TeamH, "in week", line.Num)
+			continue
+		}
+		if game.Spread == line.Spread {
+			continue
+		}
+		if err := setSpread(game, line.Spread, now); err != nil {
+			log.Println("spreads:", err.Error())
+			continue
+		}
+		changed = true
+	}
+
+	return changed
+}
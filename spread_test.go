@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpreads(t *testing.T) {
+	newTestStore(t, 2021, []Game{finalGame("CHI", "GB", 20, 24, 1), finalGame("NYJ", "NYG", 17, 20, 1),
+		finalGame("DAL", "PHI", 21, 24, 1), futureGame("DEN", "KC", 1)})
+	store.seasonEnded = true
+	options.SpreadFreeze = "1h"
+	if err := checkPoolOptions(options); err != nil {
+		t.Fatal(err)
+	}
+	for team, spread := range map[string]float64{"GB": -3.5, "NYG": -3, "PHI": -7} {
+		store.season.Week[0].teamToGame[team].Spread = spread
+	}
+	tomorrow := NewDate(time.Now().AddDate(0, 0, 1))
+
+	/* GB covers, NYG pushes, DAL covers as the underdog */
+	u := addTestUser("fred")
+	u.UserWeeks[0].Selections = []Selection{{Team: "GB", Confidence: 5}, {Team: "NYG", Confidence: 4}, {Team: "PHI", Confidence: 2}}
+	spread, err := newLeague("Spread", u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spreadsUsed() {
+		t.Error("spreads used without an ats league")
+	}
+	spread.Settings.PoolMode = "ats"
+
+	/* the stored points are for picking the winner, the league scores the spread */
+	updateUserScoresWeekIndex(0)
+	if uw := u.UserWeeks[0]; uw.Points != 11 || uw.GoodPicks != 3 {
+		t.Error("expected 11 points for the winners, got", uw.Points, uw.GoodPicks)
+	}
+	if uw := spread.weeks(u, 2021)[0]; uw.Points != 5 || uw.GoodPicks != 1 || uw.Pushes != 1 {
+		t.Error("expected 5 points, 1 good pick and 1 push, got", uw.Points, uw.GoodPicks, uw.Pushes)
+	}
+	finished, _, _ := weekResults(&store.season, u.UserWeeks, 0, spread.ats())
+	if finished[1].Winner != "push" || finished[2].Winner != "DAL" || finished[0].Line != "Packers -3.5" {
+		t.Error("wrong results", finished)
+	}
+	if rows := seasonStandings(2021, spread); len(rows) != 1 || rows[0].Pushes != 1 || rows[0].Total != 5 {
+		t.Error("wrong standings", rows)
+	}
+
+	/* a push scores like a tie */
+	options.TieScoring = "half"
+	if uw := spread.weeks(u, 2021)[0]; uw.Points != 7 {
+		t.Error("expected 7 points with half for a push, got", uw.Points)
+	}
+
+	/* the file only changes games that are not frozen */
+	ioutil.WriteFile(options.SpreadFile, []byte("week,visitor,home,spread\n1,Broncos,Chiefs,-9.5\n1,CHI,GB,-10\n"), 0600)
+	if !loadSpreads() {
+		t.Error("no spreads loaded")
+	}
+	if kc, gb := store.season.Week[0].teamToGame["KC"], store.season.Week[0].teamToGame["GB"]; kc.Spread != -9.5 || gb.Spread != -3.5 {
+		t.Error("wrong spreads", kc.Spread, gb.Spread)
+	}
+
+	if err := setSpread(store.season.Week[0].teamToGame["KC"], 2.25, time.Now()); err == nil {
+		t.Error("quarter point spread accepted")
+	}
+	if err := setSpread(store.season.Week[0].teamToGame["KC"], 1.5, tomorrow.AddDayTime("12:30 PM")); err == nil {
+		t.Error("spread changed while frozen")
+	}
+
+	if _, err := readSpreads(strings.NewReader("1,Bears,Nobody,3\n"), 2021); err == nil {
+		t.Error("unknown team accepted")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+/* How a player's weeks add up in the standings, options.Standings.
+ *
+ * By default the total is the points of every week that counts.
+ * With MissedWeek "lowest" a week the player made no picks for
+ * scores the lowest points of the players who did, less
+ * MissedPenalty and never below 0.  Then the player's DropLowest
+ * worst weeks are left out, and with BestOf only that many of the
+ * best weeks count.  The standings are ranked by this adjusted total
+ * and show the raw total, the points actually scored, next to it.
+ * The playoff leaderboard always uses the raw total. */
+
+import (
+	"fmt"
+	"sort"
+)
+
+type StandingsRules struct {
+	DropLowest    int    // the player's lowest weeks that do not count
+	BestOf        int    // only the player's best weeks count, 0 for all
+	MissedWeek    string // "zero" (default) or "lowest", see above
+	MissedPenalty int    // taken off the lowest score for a missed week
+}
+
+/* Whether the standings total is not just the points */
+func standingsAdjusted() bool {
+	s := options.Standings
+	return s.DropLowest > 0 || s.BestOf > 0 || s.MissedWeek == "lowest"
+}
+
+func checkStandingsRules(s StandingsRules) error {
+	switch s.MissedWeek {
+	case "", "zero", "lowest":
+	default:
+		return fmt.Errorf("unknown Standings.MissedWeek %q", s.MissedWeek)
+	}
+	if s.DropLowest < 0 || s.BestOf < 0 || s.MissedPenalty < 0 {
+		return fmt.Errorf("Standings.DropLowest, BestOf and MissedPenalty can not be negative")
+	}
+	return nil
+}
+
+/* What a missed week scores, lowest is the week's lowest score */
+func missedWeekPoints(lowest int) int {
+	if options.Standings.MissedWeek != "lowest" || lowest < options.Standings.MissedPenalty {
+		return 0
+	}
+	return lowest - options.Standings.MissedPenalty
+}
+
+/* The total of a player's weeks after dropping the
+ * lowest and keeping the best */
+func adjustedTotal(points []int) int {
+	sorted := append([]int(nil), points...)
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+
+	n := len(sorted) - options.Standings.DropLowest
+	if options.Standings.BestOf > 0 && options.Standings.BestOf < n {
+		n = options.Standings.BestOf
+	}
+
+	total := 0
+	for i := 0; i < n; i++ {
+		total += sorted[i]
+	}
+	return total
+}
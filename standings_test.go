@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+func TestStandingsRules(t *testing.T) {
+	weeks := make([][]Game, 4)
+	for i := range weeks {
+		weeks[i] = []Game{finalGame("CHI", "GB", 21, 7, 8)}
+	}
+	newTestStore(t, 2021, weeks...)
+	store.iWeek = 3
+	store.seasonEnded = true
+
+	/* -1 is a missed week */
+	for name, points := range map[string][]int{"fred": {10, 20, 30, 40}, "barney": {50, -1, 30, 12}} {
+		u := addTestUser(name)
+		for i, p := range points {
+			if p >= 0 {
+				u.UserWeeks[i].Points = p
+				u.UserWeeks[i].Selections = []Selection{{Team: "CHI", Confidence: 1}}
+			}
+		}
+	}
+	for _, test := range []struct {
+		rules        StandingsRules
+		fred, barney int
+	}{
+		{StandingsRules{}, 100, 92},
+		{StandingsRules{DropLowest: 1}, 90, 92},
+		{StandingsRules{BestOf: 2}, 70, 80},
+		{StandingsRules{DropLowest: 1, BestOf: 2}, 70, 80},
+		/* barney's missed week 2 scores fred's 20 less 5 */
+		{StandingsRules{MissedWeek: "lowest", MissedPenalty: 5}, 100, 107},
+		{StandingsRules{MissedWeek: "lowest", MissedPenalty: 5, DropLowest: 1}, 90, 95},
+	} {
+		options.Standings = test.rules
+		if err := checkStandingsRules(test.rules); err != nil {
+			t.Error(err)
+		}
+		totals := make(map[string]StandingRow)
+		for _, row := range getStandings() {
+			totals[row.Name] = row
+		}
+		if totals["fred"].Total != test.fred || totals["barney"].Total != test.barney {
+			t.Errorf("%+v: fred %d barney %d, expected %d and %d", test.rules,
+				totals["fred"].Total, totals["barney"].Total, test.fred, test.barney)
+		}
+		if totals["fred"].RawTotal != 100 || totals["barney"].RawTotal != 92 {
+			t.Errorf("%+v: raw totals changed %+v", test.rules, totals)
+		}
+	}
+
+	if checkStandingsRules(StandingsRules{MissedWeek: "average"}) == nil {
+		t.Error("unknown MissedWeek accepted")
+	}
+}
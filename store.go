@@ -0,0 +1,104 @@
+package main
+
+/* Shared state.
+ *
+ * The users and the season are read by every HTTP handler and
+ * changed by updateGames() in its own goroutine and by the POST
+ * handlers, so all access goes through the store and its lock.
+ *
+ * HTTP handlers are wrapped with storeReader() or storeWriter()
+ * (see webSrv) which hold the lock while the handler runs.  The
+ * response is buffered and only sent to the client after the lock
+ * is released, so a slow client never holds up the score updates.
+ * Everybody else locks the store themselves. */
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+)
+
+type Store struct {
+	sync.RWMutex
+
+	// will be indexed by user email
+	users map[string]*User
+
+	season Season
+
+	/* Earlier seasons by year, read only, see season.go */
+	archive map[int]*Season
+
+	/* by league id, see league.go */
+	leagues map[string]*League
+
+	/* adjustments entered by the administrators, see ledger.go */
+	ledger []LedgerEntry
+
+	/* Current index into season.Week[] */
+	iWeek int
+
+	seasonEnded bool
+}
+
+var store = Store{leagues: make(map[string]*League)}
+
+/**********************************************************/
+
+/* Holds the response of a handler until the store is unlocked */
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) send(w http.ResponseWriter) {
+	for k, v := range b.header {
+		w.Header()[k] = v
+	}
+	if b.status != 0 {
+		w.WriteHeader(b.status)
+	}
+	w.Write(b.body.Bytes())
+}
+
+/* For handlers that only look at the store */
+func storeReader(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b := &bufferedResponse{header: make(http.Header)}
+		func() {
+			store.RLock()
+			defer store.RUnlock()
+			h(b, r)
+		}()
+		b.send(w)
+	}
+}
+
+/* For handlers that change users or the season */
+func storeWriter(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b := &bufferedResponse{header: make(http.Header)}
+		func() {
+			store.Lock()
+			defer store.Unlock()
+			h(b, r)
+		}()
+		b.send(w)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+/* Gives the test a store of its own for season year, with a week
+ * for each list of games, no users and no leagues.  The log is
+ * quiet, the templates and the teams are loaded, and the files the
+ * store writes go to a directory of its own, through the options
+ * and the user and outbox directories.  The options can be changed
+ * freely, they and the teams are put back when the test is over. */
+func newTestStore(t *testing.T, year int, weeks ...[]Game) {
+	t.Helper()
+
+	log.SetOutput(ioutil.Discard)
+	savedOptions, savedTeams := options, teams
+	savedUserStore, savedOutboxDir := userStore, outboxDir
+
+	var err error
+	teams, err = loadTeams("teams.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates = template.Must(template.New("").Funcs(templateFuncs).ParseGlob("templates/*.html"))
+
+	dir := t.TempDir()
+	options.ArchiveDir = dir
+	options.LeagueFile = filepath.Join(dir, "leagues.xml")
+	options.AuditLog = filepath.Join(dir, "audit.log")
+	options.LedgerFile = filepath.Join(dir, "ledger.xml")
+	options.SpreadFile = filepath.Join(dir, "spreads.csv")
+	options.OutboxDir = filepath.Join(dir, "outbox")
+	options.MailDir = filepath.Join(dir, "mail")
+	userStore = &xmlDirStore{dir: filepath.Join(dir, "users")}
+	os.Mkdir(filepath.Join(dir, "users"), 0700)
+
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		options, teams = savedOptions, savedTeams
+		userStore, outboxDir = savedUserStore, savedOutboxDir
+	})
+
+	store.season = *newSeason(year, len(weeks))
+	for i, games := range weeks {
+		store.season.Week[i].Games = games
+		store.season.Week[i].index()
+	}
+	store.iWeek = 0
+	store.seasonEnded = false
+	store.archive = nil
+	store.users = make(map[string]*User)
+	store.leagues = make(map[string]*League)
+	store.ledger = nil
+}
+
+/* A game that finished days ago */
+func finalGame(teamV string, teamH string, scoreV int, scoreH int, daysAgo int) Game {
+	return Game{TeamV: teamV, TeamH: teamH, ScoreV: strconv.Itoa(scoreV), ScoreH: strconv.Itoa(scoreH),
+		Time: "FINAL", Day: *NewDate(time.Now().AddDate(0, 0, -daysAgo)), Status: Finished}
+}
+
+/* A game at 1:00 PM days from now */
+func futureGame(teamV string, teamH string, days int) Game {
+	return Game{TeamV: teamV, TeamH: teamH, Time: "1:00 PM", Day: *NewDate(time.Now().AddDate(0, 0, days)), Status: Future}
+}
+
+/* A user with no picks for every week of the season, name@foo.com */
+func addTestUser(name string) *User {
+	u := &User{Email: name + "@foo.com", Name: name, Season: store.season.Year, UserWeeks: newUserWeeks(len(store.season.Week))}
+	store.users[u.Email] = u
+	return u
+}
+
+/* A session cookie for the user */
+func testCookie(u *User) *http.Cookie {
+	sessionSecret = []byte("test secret")
+	w := httptest.NewRecorder()
+	setSession(w, u)
+	return w.Result().Cookies()[0]
+}
+
+/**********************************************************/
+
+/* Page loads while the scores are being updated, run with -race */
+func TestStoreConcurrency(t *testing.T) {
+	weeks := make([][]Game, 17)
+	for i := range weeks {
+		weeks[i] = []Game{futureGame("CHI", "GB", 1), futureGame("NYJ", "NYG", 1)}
+	}
+	newTestStore(t, 2020, weeks...)
+	store.iWeek = 1
+	mux := newMux()
+
+	cookies := make([]*http.Cookie, 0)
+	for i := 0; i < 3; i++ {
+		u := addTestUser("user" + strconv.Itoa(i))
+		for iw := range u.UserWeeks {
+			u.UserWeeks[iw].Selections = []Selection{{Team: "CHI", Confidence: 16}, {Team: "NYG", Confidence: 15}}
+		}
+		cookies = append(cookies, testCookie(u))
+	}
+
+	paths := []string{"/", "/user", "/profile", "/select/0", "/selectLogo/0", "/results/user1@foo.com/0", "/analyze/0"}
+
+	var wg sync.WaitGroup
+	for i, cookie := range cookies {
+		wg.Add(1)
+		go func(i int, cookie *http.Cookie) {
+			defer wg.Done()
+			for n := 0; n < 20; n++ {
+				for _, path := range paths {
+					r := httptest.NewRequest("GET", path, nil)
+					r.AddCookie(cookie)
+					w := httptest.NewRecorder()
+					mux.ServeHTTP(w, r)
+					if w.Code != http.StatusOK {
+						t.Error(path, "status", w.Code)
+					}
+				}
+			}
+		}(i, cookie)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for n := 0; n < 20; n++ {
+			inProgress := Game{TeamV: "NYJ", TeamH: "NYG", ScoreV: "7", ScoreH: strconv.Itoa(n), Time: "Q2",
+				Day: *NewDate(time.Now()), Status: InProgress}
+			games := []Game{finalGame("CHI", "GB", n, 3, 0), inProgress}
+			updateWeekGames(0, games)
+		}
+	}()
+
+	wg.Wait()
+
+	store.RLock()
+	defer store.RUnlock()
+	if p := store.users["user0@foo.com"].UserWeeks[0].Points; p != 16+15 {
+		t.Error("expected 31 points, got", p)
+	}
+}
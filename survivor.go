@@ -0,0 +1,421 @@
+package main
+
+/* Survivor pools, leagues with the survivor PoolMode setting.
+ *
+ * Each week of the regular season a player picks one team to win.
+ * A team can only be picked once a season.  A pick that loses, or
+ * ties unless options.TieScoring says a tie is worth something,
+ * eliminates the player, see scorePick().  So does a week with no
+ * pick once the player has started.  The last players standing win.
+ *
+ * The pick is kept in UserWeek.Survivor, apart from the confidence
+ * picks, and counts in every survivor league the player is in.  A
+ * survivor league scores it as the week's only Selection with a
+ * confidence of 1, see survivorWeeks(), so Points is 1 for each week
+ * survived and the standings and results pages work as they are.
+ * The pick can be changed until either game starts.  Others only
+ * see it once the game has started. */
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* Caller must hold the store lock, at least for reading.
+ * The survivor leagues the user is in. */
+func survivorLeagues(user *User) []*League {
+	leagues := make([]*League, 0)
+	for _, l := range leaguesOf(user) {
+		if l.survivor() {
+			leagues = append(leagues, l)
+		}
+	}
+	return leagues
+}
+
+/* The survivor pick for the week, "" for none */
+func (uw *UserWeek) survivorPick() string {
+	return uw.Survivor
+}
+
+/* Caller must hold the store lock, at least for reading.  The weeks
+ * with the survivor pick as the only selection, scored 1 if it won. */
+func survivorWeeks(season *Season, weeks []UserWeek) []UserWeek {
+	if weeks == nil {
+		return nil
+	}
+
+	scored := make([]UserWeek, len(weeks))
+	for iw := range weeks {
+		uw := UserWeek{Num: weeks[iw].Num}
+		team := weeks[iw].survivorPick()
+		if team != "" {
+			uw.Selections = []Selection{{Team: team, Confidence: 1}}
+		}
+		if season != nil && iw < len(season.Week) {
+			if game := season.Week[iw].teamToGame[team]; game != nil {
+				if score, ok := scorePick(game, Selection{Team: team, Confidence: 1}, false); ok {
+					uw.Points = score.Points
+					if score.Good {
+						uw.GoodPicks = 1
+					}
+				}
+			}
+		}
+		scored[iw] = uw
+	}
+	return scored
+}
+
+/* The teams picked in the other weeks, team to week index */
+func usedTeams(weeks []UserWeek, except int) map[string]int {
+	used := make(map[string]int)
+	for iw := range weeks {
+		if team := weeks[iw].survivorPick(); iw != except && team != "" {
+			used[team] = iw
+		}
+	}
+	return used
+}
+
+type SurvivorStatus struct {
+	Alive   bool
+	Out     int // week index the player was eliminated, -1 if alive
+	Wins    int
+	Started bool // made a pick
+}
+
+/* Caller must hold the store lock, at least for reading.
+ * How a player's survivor season is going. */
+func survivorStatus(season *Season, weeks []UserWeek) SurvivorStatus {
+	status := SurvivorStatus{Alive: true, Out: -1}
+
+	for iw := 0; iw < len(season.Week) && iw < len(weeks); iw++ {
+		week := &season.Week[iw]
+		if week.Playoff {
+			break
+		}
+
+		team := weeks[iw].survivorPick()
+		if team == "" {
+			if status.Started && week.finished() {
+				status.Alive, status.Out = false, iw
+				break
+			}
+			continue
+		}
+		status.Started = true
+
+		game := week.teamToGame[team]
+		if game == nil || game.Status != Finished {
+			continue
+		}
+		score, ok := scorePick(game, Selection{Team: team, Confidence: 1}, false)
+		if !ok {
+			continue
+		}
+		if score.Points == 0 {
+			status.Alive, status.Out = false, iw
+			break
+		}
+		status.Wins++
+	}
+
+	return status
+}
+
+/* Caller must hold the store lock.  Saves the player's survivor pick
+ * for the week.  The administrator, anyTime, can change a pick after
+ * the game started and a team of "" takes the pick away. */
+func saveSurvivorPick(user *User, week int, team string, anyTime bool) error {
+	if week < 0 || week >= len(store.season.Week) || week >= len(user.UserWeeks) {
+		return fmt.Errorf("week index %d does not exist", week)
+	}
+	w := &store.season.Week[week]
+	if w.Playoff {
+		return fmt.Errorf("The survivor pool is over after the regular season")
+	}
+
+	uw := &user.UserWeeks[week]
+	now := time.Now().Round(0) // Round(0) strips monotonic clock reading
+
+	if !anyTime {
+		if len(survivorLeagues(user)) == 0 {
+			return fmt.Errorf("You are not in a survivor league")
+		}
+		status := survivorStatus(&store.season, user.UserWeeks)
+		if !status.Alive && status.Out < week {
+			return fmt.Errorf("You are out, eliminated in %s", store.season.Week[status.Out].name())
+		}
+		if old := w.teamToGame[uw.survivorPick()]; old != nil && old.started(now) {
+			return fmt.Errorf("Your pick %s has already played", teams.name(uw.survivorPick(), store.season.Year))
+		}
+	}
+
+	if team == "" {
+		if !anyTime {
+			return fmt.Errorf("Pick a team")
+		}
+		uw.Survivor = ""
+		writeUserFile(user)
+		return nil
+	}
+
+	game := w.teamToGame[team]
+	if game == nil {
+		return fmt.Errorf("%s does not play in %s", teams.name(team, store.season.Year), w.name())
+	}
+	if !anyTime && game.started(now) {
+		return fmt.Errorf("%s at %s has started", teams.name(game.TeamV, store.season.Year),
+			teams.name(game.TeamH, store.season.Year))
+	}
+	if iw, used := usedTeams(user.UserWeeks, week)[team]; used {
+		return fmt.Errorf("You picked %s in %s", teams.name(team, store.season.Year), store.season.Week[iw].name())
+	}
+
+	log.Println("user", user.Email, "survivor pick", team, "week index", week)
+	uw.Survivor = team
+	writeUserFile(user)
+
+	return nil
+}
+
+/**********************************************************/
+
+func survivorGetHandler(w http.ResponseWriter, r *http.Request) {
+	user := getSessionUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+
+	if len(survivorLeagues(user)) == 0 {
+		errorPage(w, "You are not in a survivor league")
+		return
+	}
+
+	/* path will look something like /survivor/1 */
+	field := strings.TrimPrefix(r.URL.Path, "/survivor/")
+	week, err := strconv.Atoi(field)
+	if err != nil || week < 0 || week >= len(store.season.Week) || week >= len(user.UserWeeks) {
+		errorPage(w, "No week index %s", field)
+		return
+	}
+
+	type TeamChoice struct {
+		Team    string
+		Checked bool
+		Used    string // the week the team was picked
+	}
+	type GameRow struct {
+		Status  string
+		Started bool
+		V       TeamChoice
+		H       TeamChoice
+	}
+
+	now := time.Now()
+	pick := user.UserWeeks[week].survivorPick()
+	used := usedTeams(user.UserWeeks, week)
+	choice := func(team string) TeamChoice {
+		c := TeamChoice{Team: team, Checked: team == pick}
+		if iw, ok := used[team]; ok {
+			c.Used = store.season.Week[iw].name()
+		}
+		return c
+	}
+
+	games := make([]GameRow, 0, len(store.season.Week[week].Games))
+	for _, game := range store.season.Week[week].Games {
+		row := GameRow{
+			Status:  game.Time,
+			Started: game.started(now),
+			V:       choice(game.TeamV),
+			H:       choice(game.TeamH),
+		}
+		if game.Status == Future {
+			row.Status = game.Day.AddDayTime(game.Time).Format("Mon Jan _2 3:04pm MST")
+		}
+		games = append(games, row)
+	}
+
+	status := survivorStatus(&store.season, user.UserWeeks)
+	out := ""
+	if !status.Alive {
+		out = store.season.Week[status.Out].name()
+	}
+
+	data := struct {
+		User     string
+		Week     int
+		WeekName string
+		Playoff  bool
+		Pick     string
+		Out      string
+		Games    []GameRow
+	}{
+		User:     user.Name,
+		Week:     week,
+		WeekName: store.season.Week[week].name(),
+		Playoff:  store.season.Week[week].Playoff,
+		Pick:     pick,
+		Out:      out,
+		Games:    games,
+	}
+
+	err = templates.ExecuteTemplate(w, "survivor.html", &data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func survivorPostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getSessionUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+
+	field := strings.TrimPrefix(r.URL.Path, "/SaveSurvivor/")
+	week, err := strconv.Atoi(field)
+	if err != nil {
+		errorPage(w, "No week index %s", field)
+		return
+	}
+
+	if err := saveSurvivorPick(user, week, r.FormValue("team"), false); err != nil {
+		errorPage(w, "%s", err.Error())
+		return
+	}
+
+	http.Redirect(w, r, "/user", http.StatusFound)
+}
+
+/* Who is still alive in a survivor league, ?league=<id> or the
+ * user's first one, and for this season or an earlier one,
+ * ?season=<year> */
+func survivorStandingsGetHandler(w http.ResponseWriter, r *http.Request) {
+	user := getSessionUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+
+	season := requestSeason(r)
+	if season == nil {
+		errorPage(w, "No season %s", r.FormValue("season"))
+		return
+	}
+	league, err := requestLeague(r, user)
+	if err != nil {
+		errorPage(w, "%s", err.Error())
+		return
+	}
+	if r.FormValue("league") == "" {
+		league = nil
+		if leagues := survivorLeagues(user); len(leagues) > 0 {
+			league = leagues[0]
+		}
+	}
+	if !league.survivor() {
+		errorPage(w, "Not a survivor league")
+		return
+	}
+
+	type PickCell struct {
+		Team   string
+		Result string // W, L or "" if not played yet
+	}
+	type SurvivorRow struct {
+		Name   string
+		Alive  bool
+		Out    int
+		Status string
+		Wins   int
+		Picks  []PickCell
+	}
+
+	/* the weeks so far */
+	weeks := make([]string, 0, len(season.Week))
+	for i := 0; i < len(season.Week) && !season.Week[i].Playoff; i++ {
+		if season == &store.season && i > store.iWeek {
+			break
+		}
+		weeks = append(weeks, season.Week[i].name())
+	}
+
+	now := time.Now()
+	rows := make([]SurvivorRow, 0)
+	for _, u := range store.users {
+		uWeeks := u.weeks(season.Year)
+		if !league.includes(u) {
+			continue
+		}
+		status := survivorStatus(season, uWeeks)
+		if !status.Started {
+			continue
+		}
+
+		row := SurvivorRow{Name: u.Name, Alive: status.Alive, Out: status.Out, Wins: status.Wins, Status: "alive"}
+		if !status.Alive {
+			row.Status = "out in " + season.Week[status.Out].name()
+		}
+		for iw := range weeks {
+			cell := PickCell{}
+			if iw < len(uWeeks) {
+				team := uWeeks[iw].survivorPick()
+				game := season.Week[iw].teamToGame[team]
+				/* keep picks secret until the game starts */
+				if game != nil && (u == user || game.started(now)) {
+					cell.Team = team
+					if score, ok := scorePick(game, Selection{Team: team, Confidence: 1}, false); ok && game.Status == Finished {
+						cell.Result = "W"
+						if score.Points == 0 {
+							cell.Result = "L"
+						}
+					}
+				}
+			}
+			row.Picks = append(row.Picks, cell)
+		}
+		rows = append(rows, row)
+	}
+
+	/* alive first, then who lasted longest */
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Alive != rows[j].Alive {
+			return rows[i].Alive
+		}
+		if rows[i].Out != rows[j].Out {
+			return rows[i].Out > rows[j].Out
+		}
+		if rows[i].Wins != rows[j].Wins {
+			return rows[i].Wins > rows[j].Wins
+		}
+		return rows[i].Name < rows[j].Name
+	})
+
+	data := struct {
+		Name   string
+		Year   int
+		League string
+		Weeks  []string
+		Rows   []SurvivorRow
+	}{
+		Name:   user.Name,
+		Year:   season.Year,
+		League: league.Name,
+		Weeks:  weeks,
+		Rows:   rows,
+	}
+
+	err = templates.ExecuteTemplate(w, "survivorstandings.html", &data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
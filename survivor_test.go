@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSurvivor(t *testing.T) {
+	newTestStore(t, 2021,
+		[]Game{finalGame("CHI", "GB", 21, 7, 8), finalGame("NYJ", "NYG", 20, 24, 8)},
+		[]Game{finalGame("CHI", "DET", 7, 10, 1), finalGame("GB", "MIN", 30, 3, 1)},
+		[]Game{futureGame("CHI", "MIN", 1), futureGame("GB", "DET", 1)})
+	store.iWeek = 2
+
+	for _, name := range []string{"fred", "barney", "wilma", "betty"} {
+		addTestUser(name)
+	}
+	fred := store.users["fred@foo.com"]
+	barney := store.users["barney@foo.com"]
+	wilma := store.users["wilma@foo.com"]
+
+	/* a survivor league, betty is only in the confidence pool */
+	last, err := newLeague("Last Man", fred)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last.Settings.PoolMode = "survivor"
+	last.addMember(barney.Email)
+	last.addMember(wilma.Email)
+
+	fred.UserWeeks[0].Survivor = "CHI"
+	fred.UserWeeks[1].Survivor = "GB"
+	barney.UserWeeks[0].Survivor = "NYJ"
+	wilma.UserWeeks[0].Survivor = "CHI"
+	/* the confidence picks are apart from the survivor pick */
+	fred.UserWeeks[0].Selections = []Selection{{Team: "GB", Confidence: 2}}
+
+	for _, test := range []struct {
+		user   *User
+		status SurvivorStatus
+	}{
+		{fred, SurvivorStatus{Alive: true, Out: -1, Wins: 2, Started: true}},
+		{barney, SurvivorStatus{Alive: false, Out: 0, Wins: 0, Started: true}},
+		/* missed a week */
+		{wilma, SurvivorStatus{Alive: false, Out: 1, Wins: 1, Started: true}},
+		{store.users["betty@foo.com"], SurvivorStatus{Alive: true, Out: -1, Wins: 0, Started: false}},
+	} {
+		if status := survivorStatus(&store.season, test.user.UserWeeks); status != test.status {
+			t.Errorf("%s: got %+v, expected %+v", test.user.Name, status, test.status)
+		}
+	}
+
+	if err := saveSurvivorPick(fred, 2, "CHI", false); err == nil {
+		t.Error("picked CHI a second time")
+	}
+	if err := saveSurvivorPick(fred, 2, "MIN", false); err != nil || fred.UserWeeks[2].survivorPick() != "MIN" {
+		t.Error("could not pick MIN", err)
+	}
+	if err := saveSurvivorPick(barney, 2, "GB", false); err == nil {
+		t.Error("barney picked after being eliminated")
+	}
+	if err := saveSurvivorPick(fred, 1, "DET", false); err == nil {
+		t.Error("changed a pick after the game")
+	}
+
+	/* the administrator can fix a pick after the game */
+	if err := saveSurvivorPick(barney, 0, "NYG", true); err != nil {
+		t.Error("admin could not change the pick", err)
+	}
+	if status := survivorStatus(&store.season, barney.UserWeeks); status.Out != 1 {
+		t.Error("barney should last until missing week 2", status)
+	}
+	if err := saveSurvivorPick(store.users["betty@foo.com"], 2, "GB", false); err == nil {
+		t.Error("betty picked without a survivor league")
+	}
+
+	/* the league scores the survivor pick, others see it once the game starts */
+	if s := seasonStandings(2021, last); len(s) != 3 || s[0].Name != "fred" || s[0].Total != 2 {
+		t.Error("wrong survivor league standings", s)
+	}
+	finished, _, _ := weekResults(&store.season, last.weeks(fred, 2021), 0, false)
+	if len(finished) != 1 || finished[0].Pick != "CHI" || finished[0].Points != 1 {
+		t.Error("survivor pick not in the results", finished)
+	}
+	mux := newMux()
+	for who, want := range map[*User]int{fred: 1, wilma: 0} {
+		r := httptest.NewRequest("GET", "/api/v1/results/fred@foo.com/2?league=last-man", nil)
+		r.AddCookie(testCookie(who))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		var results apiResults
+		if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+			t.Fatal(err, w.Body.String())
+		}
+		if len(results.Future) != want {
+			t.Error(who.Name, "sees", len(results.Future), "of fred's future survivor picks")
+		}
+	}
+}
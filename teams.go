@@ -0,0 +1,227 @@
+package main
+
+/* The teams, read from options.TeamFile (default teams.json).
+ *
+ * Each entry is a team under one name in one city for the seasons
+ * From through To (0 for no limit).  A renamed or relocated team has
+ * an entry for each name with the same ID, so the ID stays the same:
+ *
+ *   {"ID": "LV", "City": "Oakland", "Name": "Raiders", "Logo": "OAK.svg",
+ *    "Conference": "AFC", "Division": "West", "To": 2019},
+ *   {"ID": "LV", "City": "Las Vegas", "Name": "Raiders", "Logo": "LV.svg",
+ *    "Conference": "AFC", "Division": "West", "From": 2020}
+ *
+ * Games and picks keep the ID.  The schedule's names are resolved to
+ * IDs when it is read, by ID, name, city, city and name, or one of
+ * the aliases, preferring the entries for the season.  A city with
+ * two teams that season does not resolve, it needs an alias.  Seasons
+ * and users saved with team names are moved to IDs when loaded.
+ *
+ * The pages show Name, see the "team" and "logo" template functions. */
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+type Team struct {
+	ID         string   // stable abbreviation, the same across renames and moves
+	Name       string   // "Bears", what the pages show
+	City       string   // "Chicago"
+	Aliases    []string // other names for the team, "NY Giants"
+	Logo       string   // in resources/logos
+	Conference string
+	Division   string
+	From       int // first season, 0 for always
+	To         int // last season, 0 for still
+}
+
+type TeamRegistry struct {
+	Teams []Team
+}
+
+var teams = &TeamRegistry{}
+
+/**********************************************************/
+
+func loadTeams(fileName string) (*TeamRegistry, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	reg := &TeamRegistry{}
+	if err := json.Unmarshal(b, &reg.Teams); err != nil {
+		return nil, fmt.Errorf("%s: %v", fileName, err)
+	}
+
+	for i, t := range reg.Teams {
+		if t.ID == "" || t.Name == "" {
+			return nil, fmt.Errorf("%s: team %d needs an ID and a Name", fileName, i+1)
+		}
+		if t.To != 0 && t.From > t.To {
+			return nil, fmt.Errorf("%s: %s %s ends before it starts", fileName, t.ID, t.Name)
+		}
+	}
+
+	log.Println("loaded", len(reg.Teams), "teams from", fileName)
+	return reg, nil
+}
+
+func (t *Team) inSeason(year int) bool {
+	return (t.From == 0 || t.From <= year) && (t.To == 0 || year <= t.To)
+}
+
+func (t *Team) FullName() string {
+	return t.City + " " + t.Name
+}
+
+func (t *Team) known(name string) bool {
+	if strings.EqualFold(name, t.ID) || strings.EqualFold(name, t.Name) ||
+		strings.EqualFold(name, t.City) || strings.EqualFold(name, t.FullName()) {
+		return true
+	}
+	for _, alias := range t.Aliases {
+		if strings.EqualFold(name, alias) {
+			return true
+		}
+	}
+	return false
+}
+
+/* The ID of the only team known by name, "" if none or more than one */
+func (reg *TeamRegistry) match(name string, year int, anySeason bool) string {
+	id := ""
+	for i := range reg.Teams {
+		t := &reg.Teams[i]
+		if (!anySeason && !t.inSeason(year)) || !t.known(name) {
+			continue
+		}
+		if id != "" && id != t.ID {
+			return ""
+		}
+		id = t.ID
+	}
+	return id
+}
+
+/* The ID of the team with this name in the season, or any
+ * season if no team had it that season */
+func (reg *TeamRegistry) resolve(name string, year int) (string, error) {
+	name = strings.TrimSpace(name)
+	id := reg.match(name, year, false)
+	if id == "" {
+		id = reg.match(name, year, true)
+	}
+	if id == "" {
+		return "", fmt.Errorf("unknown team %q", name)
+	}
+	return id, nil
+}
+
+/* The team with this ID in the season, its closest entry if
+ * there is none that season, nil if no team has the ID */
+func (reg *TeamRegistry) team(id string, year int) *Team {
+	var found *Team
+	for i := range reg.Teams {
+		t := &reg.Teams[i]
+		if t.ID != id {
+			continue
+		}
+		if t.inSeason(year) {
+			return t
+		}
+		if found == nil || (t.To != 0 && t.To < year) {
+			found = t
+		}
+	}
+	return found
+}
+
+/* What the pages show for the team, the ID if there is no such team */
+func (reg *TeamRegistry) name(id string, year int) string {
+	if t := reg.team(id, year); t != nil {
+		return t.Name
+	}
+	return id
+}
+
+func (reg *TeamRegistry) logo(id string, year int) string {
+	if t := reg.team(id, year); t != nil {
+		return t.Logo
+	}
+	return ""
+}
+
+/* Replaces the team names in games with their IDs */
+func resolveGames(games []Game, year int) error {
+	for i := range games {
+		v, err := teams.resolve(games[i].TeamV, year)
+		if err != nil {
+			return err
+		}
+		h, err := teams.resolve(games[i].TeamH, year)
+		if err != nil {
+			return err
+		}
+		games[i].TeamV, games[i].TeamH = v, h
+	}
+	return nil
+}
+
+/* Replaces the team names in the picks with their IDs, and
+ * returns true if any changed.  Names that do not resolve are
+ * kept as they are. */
+func resolveSelections(weeks []UserWeek, year int) bool {
+	changed := false
+	for iw := range weeks {
+		for is := range weeks[iw].Selections {
+			s := &weeks[iw].Selections[is]
+			if id, err := teams.resolve(s.Team, year); err == nil && id != s.Team {
+				s.Team = id
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+/* Caller must hold the store lock, or the user not be shared yet */
+func (u *User) resolveTeams() bool {
+	changed := resolveSelections(u.UserWeeks, u.Season)
+	for i := range u.PastSeasons {
+		if resolveSelections(u.PastSeasons[i].UserWeeks, u.PastSeasons[i].Year) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+/**********************************************************/
+
+/* The templates are run with the store locked, so these
+ * can look at the season.  year is optional, the current
+ * season by default:  {{team .TeamV}} or {{team .TeamV $.Year}} */
+var templateFuncs = template.FuncMap{
+	"team": func(id string, year ...int) string {
+		return teams.name(id, templateYear(year))
+	},
+	"logo": func(id string, year ...int) string {
+		return teams.logo(id, templateYear(year))
+	},
+	"ats":   spreadsUsed,
+	"money": money,
+
+	"adjusted": standingsAdjusted,
+}
+
+func templateYear(year []int) int {
+	if len(year) > 0 && year[0] != 0 {
+		return year[0]
+	}
+	return store.season.Year
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestTeams(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	defer func(saved *TeamRegistry) { teams = saved }(teams)
+	var err error
+	teams, err = loadTeams("teams.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolves := []struct {
+		name string
+		year int
+		id   string
+	}{
+		{"Chicago Bears", 2021, "CHI"},
+		{"bears", 2021, "CHI"},
+		{"Oakland", 2019, "LV"},
+		{"Las Vegas Raiders", 2020, "LV"},
+		{"San Diego", 2021, "LAC"},
+		{"LA Rams", 2021, "LA"},
+		{"Washington Redskins", 2022, "WAS"},
+		{"Commanders", 2022, "WAS"},
+		{"St. Louis Rams", 2015, "LA"},
+		{"Los Angeles", 2021, ""},
+		{"New York", 2021, ""},
+		{"Toronto Argonauts", 2021, ""},
+	}
+	for _, r := range resolves {
+		id, err := teams.resolve(r.name, r.year)
+		if id != r.id || (err == nil) != (r.id != "") {
+			t.Error(r.name, r.year, "resolved to", id, err)
+		}
+	}
+
+	if n := teams.name("WAS", 2019); n != "Redskins" {
+		t.Error("WAS in 2019 is", n)
+	}
+	if n := teams.name("WAS", 2030); n != "Commanders" {
+		t.Error("WAS in 2030 is", n)
+	}
+	if l := teams.logo("LV", 2019); l != "OAK.svg" {
+		t.Error("LV logo in 2019 is", l)
+	}
+	if l := teams.logo("LV", 2021); l != "LV.svg" {
+		t.Error("LV logo in 2021 is", l)
+	}
+	if n := teams.name("XYZ", 2021); n != "XYZ" {
+		t.Error("unknown ID shown as", n)
+	}
+
+	/* picks saved with names before there were IDs */
+	u := &User{Season: 2021, UserWeeks: newUserWeeks(1),
+		PastSeasons: []UserSeason{{Year: 2019, UserWeeks: newUserWeeks(1)}}}
+	u.UserWeeks[0].Selections = []Selection{{Team: "Bears", Confidence: 2}, {Team: "GB", Confidence: 1}}
+	u.PastSeasons[0].UserWeeks[0].Selections = []Selection{{Team: "Redskins", Confidence: 1}}
+	if !u.resolveTeams() {
+		t.Error("nothing resolved")
+	}
+	if u.UserWeeks[0].Selections[0].Team != "CHI" || u.PastSeasons[0].UserWeeks[0].Selections[0].Team != "WAS" {
+		t.Error("picks not moved to IDs", u.UserWeeks[0], u.PastSeasons[0].UserWeeks[0])
+	}
+	if u.resolveTeams() {
+		t.Error("resolved twice")
+	}
+}
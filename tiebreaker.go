@@ -0,0 +1,159 @@
+package main
+
+/* The tiebreaker, when options.Tiebreaker is set.
+ *
+ * With the picks for a week the players can predict the combined
+ * score of the week's tiebreaker game, UserWeek.Tiebreaker.  The game
+ * is the one an administrator picked, Week.Tiebreaker, or else the
+ * last game of the week, usually Monday night.
+ *
+ * Once that game is finished, of the players with the most points
+ * for the week, the one whose prediction is closest wins the week.
+ * A player with no prediction does not win a tie against one with a
+ * prediction, and if nobody predicted the players stay tied.  The
+ * results page ranks the players the same way. */
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+)
+
+/* More than any game has had, to catch typos */
+const maxTiebreaker = 200
+
+/* Caller must hold the store lock, at least for reading.
+ * The week's tiebreaker game, nil if there is none. */
+func (w *Week) tiebreakerGame() *Game {
+	if !options.Tiebreaker || len(w.Games) == 0 {
+		return nil
+	}
+	if game := w.teamToGame[w.Tiebreaker]; game != nil {
+		return game
+	}
+	return &w.Games[len(w.Games)-1]
+}
+
+/* How far the user's prediction was from the total of the
+ * tiebreaker game, -1 if there was no prediction or the
+ * game is not finished */
+func tiebreakMiss(w *Week, uw *UserWeek) int {
+	game := w.tiebreakerGame()
+	if game == nil || game.Status != Finished || uw.Tiebreaker == 0 {
+		return -1
+	}
+
+	scoreV, errV := strconv.Atoi(game.ScoreV)
+	scoreH, errH := strconv.Atoi(game.ScoreH)
+	if errV != nil || errH != nil {
+		return -1
+	}
+
+	miss := scoreV + scoreH - uw.Tiebreaker
+	if miss < 0 {
+		miss = -miss
+	}
+	return miss
+}
+
+/* Whether a is ahead of b for the week: more points, or the
+ * same points and a closer tiebreaker */
+func tiebreakAhead(w *Week, a *UserWeek, b *UserWeek) bool {
+	if a.Points != b.Points {
+		return a.Points > b.Points
+	}
+	missA, missB := tiebreakMiss(w, a), tiebreakMiss(w, b)
+	if missA < 0 {
+		return false
+	}
+	return missB < 0 || missA < missB
+}
+
+/* Which of weeks won week w, more than one only if they are
+ * still tied after the tiebreaker */
+func weekWinners(w *Week, weeks []*UserWeek) []bool {
+	won := make([]bool, len(weeks))
+	for i := range weeks {
+		won[i] = true
+		for j := range weeks {
+			if tiebreakAhead(w, weeks[j], weeks[i]) {
+				won[i] = false
+				break
+			}
+		}
+	}
+	return won
+}
+
+/* Sorts the users' weeks for week w, winners first */
+func rankWeek(w *Week, weeks []*UserWeek) {
+	sort.SliceStable(weeks, func(i, j int) bool {
+		return tiebreakAhead(w, weeks[i], weeks[j])
+	})
+}
+
+/* Caller must hold the store lock.  Saves the user's prediction for
+ * the tiebreaker game, 0 for none.  Once the game starts only the
+ * administrator, anyTime, can change it. */
+func setTiebreaker(user *User, week int, total int, anyTime bool) error {
+	if week < 0 || week >= len(store.season.Week) || week >= len(user.UserWeeks) {
+		return fmt.Errorf("week index %d does not exist", week)
+	}
+
+	game := store.season.Week[week].tiebreakerGame()
+	if game == nil {
+		return fmt.Errorf("%s has no tiebreaker", store.season.Week[week].name())
+	}
+	if total < 0 || total > maxTiebreaker {
+		return fmt.Errorf("A tiebreaker of %d points is not likely, use 1 through %d", total, maxTiebreaker)
+	}
+
+	uw := &user.UserWeeks[week]
+	if uw.Tiebreaker == total {
+		return nil
+	}
+	if !anyTime && game.started(time.Now()) {
+		return fmt.Errorf("The tiebreaker game, %s at %s, has started", teams.name(game.TeamV, store.season.Year),
+			teams.name(game.TeamH, store.season.Year))
+	}
+
+	log.Println("user", user.Email, "week", week, "tiebreaker", total)
+	uw.Tiebreaker = total
+	writeUserFile(user)
+
+	return nil
+}
+
+/* Whether the game has started, even if we have not updated its
+ * status yet */
+func (g *Game) started(now time.Time) bool {
+	if g.Status != Future {
+		return true
+	}
+	return now.After(g.Day.AddDayTime(g.Time))
+}
+
+/* For the pick forms */
+type TiebreakerTmpl struct {
+	TeamV string
+	TeamH string
+	Total int  // the user's prediction, 0 for none
+	Open  bool // the game has not started
+}
+
+/* Caller must hold the store lock, at least for reading.
+ * nil if the week has no tiebreaker. */
+func makeTiebreakerTmpl(user *User, week int) *TiebreakerTmpl {
+	game := store.season.Week[week].tiebreakerGame()
+	if game == nil || week >= len(user.UserWeeks) {
+		return nil
+	}
+	return &TiebreakerTmpl{
+		TeamV: game.TeamV,
+		TeamH: game.TeamH,
+		Total: user.UserWeeks[week].Tiebreaker,
+		Open:  !game.started(time.Now()),
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import "testing"
+
+func TestTiebreaker(t *testing.T) {
+	newTestStore(t, 2021,
+		[]Game{finalGame("CHI", "GB", 21, 7, 1), finalGame("NYJ", "NYG", 20, 24, 1)},
+		[]Game{futureGame("CHI", "DET", 1)})
+	store.iWeek = 1
+	options.Tiebreaker = true
+
+	/* three tied on points, Monday night was 44 points */
+	for name, tiebreaker := range map[string]int{"fred": 50, "barney": 40, "wilma": 0, "betty": 44} {
+		u := addTestUser(name)
+		u.UserWeeks[0].Points = 10
+		u.UserWeeks[0].Tiebreaker = tiebreaker
+	}
+	store.users["betty@foo.com"].UserWeeks[0].Points = 3
+
+	won := make(map[string]int)
+	for _, row := range seasonStandings(2021, nil) {
+		won[row.Name] = row.WeeksWon
+	}
+	if won["barney"] != 1 || won["fred"] != 0 || won["wilma"] != 0 || won["betty"] != 0 {
+		t.Error("barney should have won on the tiebreaker", won)
+	}
+
+	/* a closer prediction without the points does not help, and
+	 * with nobody predicting the high scores stay tied */
+	store.users["barney@foo.com"].UserWeeks[0].Tiebreaker = 0
+	store.users["fred@foo.com"].UserWeeks[0].Tiebreaker = 0
+	won = make(map[string]int)
+	for _, row := range seasonStandings(2021, nil) {
+		won[row.Name] = row.WeeksWon
+	}
+	if won["barney"] != 1 || won["fred"] != 1 || won["wilma"] != 1 || won["betty"] != 0 {
+		t.Error("expected a three way tie", won)
+	}
+
+	/* the admin can pick another game */
+	store.season.Week[0].Tiebreaker = "CHI"
+	if g := store.season.Week[0].tiebreakerGame(); g == nil || g.TeamH != "GB" {
+		t.Error("wrong tiebreaker game", g)
+	}
+
+	fred := store.users["fred@foo.com"]
+	if err := setTiebreaker(fred, 0, 30, false); err == nil {
+		t.Error("tiebreaker changed after the game")
+	}
+	if err := setTiebreaker(fred, 0, 30, true); err != nil || fred.UserWeeks[0].Tiebreaker != 30 {
+		t.Error("admin could not change the tiebreaker", err)
+	}
+	if err := setTiebreaker(fred, 1, 45, false); err != nil || fred.UserWeeks[1].Tiebreaker != 45 {
+		t.Error("tiebreaker not saved", err)
+	}
+	if err := setTiebreaker(fred, 1, 450, false); err == nil {
+		t.Error("450 points accepted")
+	}
+
+	options.Tiebreaker = false
+	if store.season.Week[0].tiebreakerGame() != nil {
+		t.Error("tiebreaker game with the tiebreaker off")
+	}
+}
@@ -1,18 +1,10 @@
 package main
 
-/* User info is stored as XML files in the "users" subdirectory */
+/* User info is kept in a UserStore, see userstore.go */
 
 import (
-	"crypto/tls"
-	"encoding/xml"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net"
-	"net/mail"
-	"net/smtp"
-	"os"
-	"path/filepath"
 	"time"
 
 	"crypto/hmac"
@@ -29,155 +21,97 @@ func writeUserFile(user *User) {
 	user.fileLock.Lock()
 	defer user.fileLock.Unlock()
 
-	/* write user info/sections to file */
-	userFileName := "users/" + user.Email + ".xml"
-	log.Println("writing to ", userFileName)
-	userXMLFile, err := os.Create(userFileName)
-	if err != nil {
-		log.Println(err.Error())
+	log.Println("writing user", user.Email)
+	if err := userStore.Save(user); err != nil {
+		log.Println("writing user", user.Email, ":", err.Error())
 		return
 	}
-	defer userXMLFile.Close()
-
-	enc := xml.NewEncoder(userXMLFile)
-	enc.Indent("", "    ")
-	if err := enc.Encode(user); err != nil {
-		log.Println(err.Error())
-	}
-	log.Println("wrote to ", userFileName)
+	log.Println("wrote user", user.Email)
 }
 
 /**********************************************************/
 
-func sendEmail(toUser string, subject string, body string) {
-	from := mail.Address{Name: "", Address: options.AdminEmail}
-	to := mail.Address{Name: "", Address: toUser}
-
-	// Setup headers
-	headers := make(map[string]string)
-	headers["From"] = from.String()
-	headers["To"] = to.String()
-	headers["Subject"] = subject
-
-	// Setup message
-	message := ""
-	for k, v := range headers {
-		message += fmt.Sprintf("%s: %s\r\n", k, v)
-	}
-	message += "\r\n" + body
-
-	// Connect to the SMTP Server
-	servername := "smtp.aol.com:465"
-	//	servername := "smtp.1and1.com:465"
-
-	host, _, _ := net.SplitHostPort(servername)
-
-	auth := smtp.PlainAuth("", options.AdminEmail, options.AdminEmailPw, host)
-
-	// TLS config
-	tlsconfig := &tls.Config{
-		InsecureSkipVerify: true,
-		ServerName:         host,
-	}
-
-	// Here is the key, you need to call tls.Dial instead of smtp.Dial
-	// for smtp servers running on 465 that require an ssl connection
-	// from the very beginning (no starttls)
-	conn, err := tls.Dial("tcp", servername, tlsconfig)
-	if err != nil {
-		log.Panic(err)
+/* Administrators are the users with Admin set, and the user whose
+ * email is options.AdminEmail so there is always one */
+func isAdmin(user *User) bool {
+	if user == nil || user.Disabled {
+		return false
 	}
+	return user.Admin || (options.AdminEmail != "" && user.Email == options.AdminEmail)
+}
 
-	c, err := smtp.NewClient(conn, host)
-	if err != nil {
-		log.Panic(err)
+/* Caller must hold the store lock, at least for reading.
+ * Checks a new nickname for user, nil for a new user. */
+func validateNickname(nick string, user *User) error {
+	if len(nick) == 0 {
+		return errors.New("no nickname entered")
 	}
-	defer c.Quit()
 
-	// Auth
-	if err = c.Auth(auth); err != nil {
-		log.Panic(err)
+	if len(nick) > 20 {
+		return errors.New("nickname must be less than 20 characters")
 	}
 
-	// To && From
-	if err = c.Mail(from.Address); err != nil {
-		log.Panic(err)
+	for _, u := range store.users {
+		if nick == u.Name && u != user {
+			return fmt.Errorf("nickname %s already used", nick)
+		}
 	}
 
-	if err = c.Rcpt(to.Address); err != nil {
-		log.Panic(err)
-	}
+	return nil
+}
 
-	// SECOND RECEPIENT!!
-	// if err = c.Rcpt("fred@foo.com"); err != nil {
-	// 	log.Panic(err)
-	// }
+/**********************************************************/
 
-	// Data
-	w, err := c.Data()
-	if err != nil {
-		log.Println("email c.Data", err.Error())
-		return
-	}
+type EmailKind int
 
-	_, err = w.Write([]byte(message))
-	if err != nil {
-		log.Println("email w.Write", err.Error())
-		return
-	}
+const (
+	EmailPwReset  EmailKind = iota // asked for by the user, always sent
+	EmailSecurity                  // EmailPrefs.Security
+	EmailReminder                  // EmailPrefs.Reminders
+	EmailResults                   // EmailPrefs.WeeklyResults
+)
 
-	err = w.Close()
-	if err != nil {
-		log.Println("email w.Close", err.Error())
-		return
+func (u *User) wantsEmail(kind EmailKind) bool {
+	if kind == EmailPwReset {
+		return true
 	}
-}
 
-/**********************************************************/
-
-func userWalk(path string, info os.FileInfo, err error) error {
-	if info.IsDir() {
-		return nil
+	if !u.Subscribe {
+		return false
 	}
 
-	if err != nil {
-		log.Println("user walk error, ", path, ":", err.Error())
-		return nil
+	switch kind {
+	case EmailSecurity:
+		return u.EmailPrefs.Security
+	case EmailReminder:
+		return u.EmailPrefs.Reminders
+	case EmailResults:
+		return u.EmailPrefs.WeeklyResults
 	}
 
-	log.Println("loading", path)
-
-	/* http://stackoverflow.com/questions/1821811/how-to-read-write-from-to-file
-	 * xml.Unmarshal()'s first argument is a []byte.  A little scary that the only
-	 * way to get a []byte from the file is to read the entire file.
-	 */
-	b, err := ioutil.ReadFile(path)
-	if err != nil {
-		fmt.Println(err.Error())
-		return nil
-	}
+	return false
+}
 
-	var user User
-	err = xml.Unmarshal(b, &user)
-	if err != nil {
-		log.Printf("error: %v\n", err)
+/* All mail to users goes through here so that their email
+ * preferences are honored.  The mail is queued, see outbox.go */
+func emailUser(user *User, kind EmailKind, subject string, body string) error {
+	if !user.wantsEmail(kind) {
+		log.Println("not sending", subject, "to", user.Email, "per email preferences")
 		return nil
 	}
 
-	users[user.Email] = &user
-
-	return nil
+	return enqueueEmail(user.Email, subject, body)
 }
 
-func getUsers() {
+/**********************************************************/
 
-	/* Init global map */
-	users = make(map[string]*User)
+func getUsers() {
+	var err error
 
-	err := filepath.Walk("users", userWalk)
+	store.users, err = userStore.Load()
 	if err != nil {
 		fmt.Println("Error getting user info:", err.Error())
-		return
+		log.Println("Error getting user info:", err.Error())
 	}
 }
 
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestWantsEmail(t *testing.T) {
+	all := EmailPrefs{Reminders: true, WeeklyResults: true, Security: true}
+	for _, test := range []struct {
+		kind      EmailKind
+		subscribe bool
+		prefs     EmailPrefs
+		want      bool
+	}{
+		/* asked for, always sent */
+		{EmailPwReset, false, EmailPrefs{}, true},
+		{EmailPwReset, true, EmailPrefs{}, true},
+		{EmailSecurity, false, all, false},
+		{EmailSecurity, true, EmailPrefs{}, false},
+		{EmailSecurity, true, EmailPrefs{Security: true}, true},
+		{EmailReminder, false, all, false},
+		{EmailReminder, true, EmailPrefs{Security: true, WeeklyResults: true}, false},
+		{EmailReminder, true, EmailPrefs{Reminders: true}, true},
+		{EmailResults, false, all, false},
+		{EmailResults, true, EmailPrefs{Reminders: true, Security: true}, false},
+		{EmailResults, true, EmailPrefs{WeeklyResults: true}, true},
+	} {
+		u := &User{Subscribe: test.subscribe, EmailPrefs: test.prefs}
+		if got := u.wantsEmail(test.kind); got != test.want {
+			t.Errorf("kind %d subscribe %v prefs %+v: got %v", test.kind, test.subscribe, test.prefs, got)
+		}
+	}
+
+	/* a user file from before the preferences */
+	u, err := decodeUser([]byte("<User><Email>fred@foo.com</Email><Subscribe>true</Subscribe></User>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.EmailPrefs != all {
+		t.Error("old subscriber does not get all mail", u.EmailPrefs)
+	}
+	b, _ := encodeUser(&User{Email: "fred@foo.com", Subscribe: true, EmailPrefs: EmailPrefs{Security: true}})
+	if u, _ := decodeUser(b); u.EmailPrefs != (EmailPrefs{Security: true}) {
+		t.Error("saved preferences not kept", u.EmailPrefs)
+	}
+}
+
+func TestEmailSubscribe(t *testing.T) {
+	newTestStore(t, 2021, nil)
+	mux := newMux()
+
+	u := addTestUser("fred")
+	u.EmailPrefs = EmailPrefs{Reminders: true, WeeklyResults: true, Security: true}
+
+	/* unchecked boxes are not sent */
+	for _, test := range []struct {
+		form      url.Values
+		subscribe bool
+		prefs     EmailPrefs
+	}{
+		{url.Values{"subscribe": {"on"}, "results": {"on"}}, true, EmailPrefs{WeeklyResults: true}},
+		{url.Values{"reminders": {"on"}, "security": {"on"}}, false, EmailPrefs{Reminders: true, Security: true}},
+		{url.Values{}, false, EmailPrefs{}},
+	} {
+		r := httptest.NewRequest("POST", "/EmailSubscribe", strings.NewReader(test.form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(testCookie(u))
+		mux.ServeHTTP(httptest.NewRecorder(), r)
+		if u.Subscribe != test.subscribe || u.EmailPrefs != test.prefs {
+			t.Error(test.form, "saved subscribe", u.Subscribe, "prefs", u.EmailPrefs)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package main
+
+/* Where the users are kept.
+ *
+ * options.UserStore picks the backend:
+ *
+ *   "xml"   one XML file per user in a directory (default "users")
+ *   "bolt"  one bbolt database file (default "users.db") with the
+ *           same XML for each user, keyed by email
+ *
+ * options.UserStorePath overrides the default directory or file.
+ *
+ * The XML files are written to a temp file first, synced, and then
+ * renamed over the old file, so a crash or a full disk never leaves
+ * a half written user.  The old file is kept in the backup
+ * subdirectory, options.UserBackups generations of it (default
+ * defaultUserBackups, -1 for none).  If a user file does not parse
+ * when loading, the newest backup that does is used instead.
+ *
+ * The -migrate-users flag copies every user from the configured
+ * store to another one, see migrateUsers(). */
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type UserStore interface {
+	Load() (map[string]*User, error)
+	Save(user *User) error
+	Delete(email string) error
+	Close() error
+}
+
+var userStore UserStore = &xmlDirStore{dir: "users"}
+
+/**********************************************************/
+
+/* spec is "kind" or "kind:path" */
+func openUserStore(spec string) (UserStore, error) {
+	kind, path := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, path = spec[:i], spec[i+1:]
+	}
+
+	switch kind {
+	case "", "xml":
+		if path == "" {
+			path = "users"
+		}
+		backups := options.UserBackups
+		if backups == 0 {
+			backups = defaultUserBackups
+		}
+		if backups < 0 {
+			backups = 0
+		}
+		if err := os.MkdirAll(filepath.Join(path, userBackupDir), 0700); err != nil {
+			return nil, err
+		}
+		return &xmlDirStore{dir: path, backups: backups}, nil
+	case "bolt":
+		if path == "" {
+			path = "users.db"
+		}
+		return openBoltStore(path)
+	}
+
+	return nil, fmt.Errorf("unknown user store %q", kind)
+}
+
+/* The store named in the options */
+func optionsUserStoreSpec(o Options) string {
+	if o.UserStorePath == "" {
+		return o.UserStore
+	}
+	return o.UserStore + ":" + o.UserStorePath
+}
+
+/* Copies all users from one store to another, returns how many */
+func migrateUsers(from UserStore, to UserStore) (int, error) {
+	users, err := from.Load()
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for email, user := range users {
+		if err := to.Save(user); err != nil {
+			return n, fmt.Errorf("saving %s: %v", email, err)
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+/**********************************************************/
+
+func encodeUser(user *User) ([]byte, error) {
+	return xml.MarshalIndent(user, "", "    ")
+}
+
+func decodeUser(b []byte) (*User, error) {
+	/* a user saved before there were email preferences
+	 * gets every kind of mail, if subscribed */
+	user := User{EmailPrefs: EmailPrefs{Reminders: true, WeeklyResults: true, Security: true}}
+	if err := xml.Unmarshal(b, &user); err != nil {
+		return nil, err
+	}
+	if user.Email == "" {
+		return nil, fmt.Errorf("user has no email")
+	}
+	return &user, nil
+}
+
+/**********************************************************/
+
+const (
+	defaultUserBackups = 5
+	userBackupDir      = "backup"
+	tempFilePrefix     = ".tmp-"
+	userBackupTime     = "20060102-150405.000000000"
+)
+
+type xmlDirStore struct {
+	dir     string
+	backups int // how many old versions of each user file to keep
+}
+
+func (s *xmlDirStore) fileName(email string) string {
+	return filepath.Join(s.dir, email+".xml")
+}
+
+/* Backups of the user's file, newest first */
+func (s *xmlDirStore) backupNames(email string) []string {
+	names, _ := filepath.Glob(filepath.Join(s.dir, userBackupDir, email+".xml.*"))
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	return names
+}
+
+func readUserFile(path string) (*User, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeUser(b)
+}
+
+func (s *xmlDirStore) Load() (map[string]*User, error) {
+	users := make(map[string]*User)
+
+	walk := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			log.Println("user walk error, ", path, ":", err.Error())
+			return nil
+		}
+
+		if info.IsDir() {
+			if path != s.dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if strings.HasPrefix(info.Name(), tempFilePrefix) {
+			/* left over from a write that did not finish */
+			log.Println("removing", path)
+			os.Remove(path)
+			return nil
+		}
+
+		if !strings.HasSuffix(path, ".xml") {
+			return nil
+		}
+
+		log.Println("loading", path)
+
+		user, err := readUserFile(path)
+		if err == nil {
+			users[user.Email] = user
+			return nil
+		}
+		log.Printf("error: %s: %v\n", path, err)
+
+		/* try the backups */
+		email := strings.TrimSuffix(info.Name(), ".xml")
+		for _, backup := range s.backupNames(email) {
+			user, err = readUserFile(backup)
+			if err != nil {
+				log.Printf("error: %s: %v\n", backup, err)
+				continue
+			}
+			log.Println("loaded", email, "from backup", backup)
+			fmt.Println("loaded", email, "from backup", backup)
+			users[user.Email] = user
+			return nil
+		}
+
+		log.Println("no good backup for", email)
+		return nil
+	}
+
+	if err := filepath.Walk(s.dir, walk); err != nil {
+		return users, err
+	}
+
+	return users, nil
+}
+
+func (s *xmlDirStore) Save(user *User) error {
+	b, err := encodeUser(user)
+	if err != nil {
+		return err
+	}
+
+	fileName := s.fileName(user.Email)
+	if s.backups > 0 {
+		if err := s.backup(user.Email); err != nil {
+			log.Println("backup of", fileName, "failed:", err.Error())
+		}
+	}
+
+	return writeFileAtomic(fileName, b)
+}
+
+/* Keeps the current user file as a backup */
+func (s *xmlDirStore) backup(email string) error {
+	fileName := s.fileName(email)
+	if _, err := os.Stat(fileName); os.IsNotExist(err) {
+		return nil
+	}
+
+	backupName := filepath.Join(s.dir, userBackupDir, email+".xml."+time.Now().Format(userBackupTime))
+
+	/* the current file is about to be replaced by a rename,
+	 * so a hard link is all the copy we need */
+	if err := os.Link(fileName, backupName); err != nil {
+		if err := copyFile(fileName, backupName); err != nil {
+			return err
+		}
+	}
+
+	backups := s.backupNames(email)
+	for len(backups) > s.backups {
+		old := backups[len(backups)-1]
+		log.Println("removing old backup", old)
+		os.Remove(old)
+		backups = backups[:len(backups)-1]
+	}
+
+	return nil
+}
+
+func (s *xmlDirStore) Delete(email string) error {
+	return os.Remove(s.fileName(email))
+}
+
+func (s *xmlDirStore) Close() error {
+	return nil
+}
+
+/* Writes a temp file next to fileName and renames it over fileName,
+ * so there is always either the old or the new file, never half of one */
+func writeFileAtomic(fileName string, b []byte) error {
+	dir, base := filepath.Split(fileName)
+	if dir == "" {
+		dir = "."
+	}
+
+	tmp, err := ioutil.TempFile(dir, tempFilePrefix+base+"-")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	if err := os.Rename(tmpName, fileName); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+func copyFile(from string, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+/* So that a rename in the directory survives a crash */
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+/**********************************************************/
+
+var boltUsersBucket = []byte("users")
+
+type boltStore struct {
+	db *bolt.DB
+}
+
+func openBoltStore(path string) (*boltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltUsersBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) Load() (map[string]*User, error) {
+	users := make(map[string]*User)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltUsersBucket).ForEach(func(k, v []byte) error {
+			log.Println("loading", string(k))
+			user, err := decodeUser(v)
+			if err != nil {
+				log.Printf("error: %s: %v\n", string(k), err)
+				return nil
+			}
+			users[user.Email] = user
+			return nil
+		})
+	})
+
+	return users, err
+}
+
+func (s *boltStore) Save(user *User) error {
+	b, err := encodeUser(user)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltUsersBucket).Put([]byte(user.Email), b)
+	})
+}
+
+func (s *boltStore) Delete(email string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltUsersBucket).Delete([]byte(email))
+	})
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateUsers(t *testing.T) {
+	dir := t.TempDir()
+
+	from, err := openUserStore("xml:" + filepath.Join(dir, "users"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, email := range []string{"fred@foo.com", "barney@foo.com"} {
+		user := &User{Email: email, Name: email[:4], UserWeeks: []UserWeek{{Num: 1, Points: 42}}}
+		if err := from.Save(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	to, err := openUserStore("bolt:" + filepath.Join(dir, "users.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer to.Close()
+
+	n, err := migrateUsers(from, to)
+	if err != nil || n != 2 {
+		t.Fatal("migrated", n, "users, err", err)
+	}
+
+	users, err := to.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users["fred@foo.com"].UserWeeks[0].Points != 42 {
+		t.Error("bolt store does not have the users", users)
+	}
+
+	if err := to.Delete("fred@foo.com"); err != nil {
+		t.Fatal(err)
+	}
+	users, _ = to.Load()
+	if _, ok := users["fred@foo.com"]; ok {
+		t.Error("fred@foo.com not deleted")
+	}
+}
+
+func TestXMLStoreBackups(t *testing.T) {
+	dir := t.TempDir()
+	options.UserBackups = 2
+	defer func() { options.UserBackups = 0 }()
+
+	s, err := openUserStore("xml:" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &User{Email: "fred@foo.com", UserWeeks: []UserWeek{{Num: 1}}}
+	for points := 1; points <= 4; points++ {
+		user.UserWeeks[0].Points = points
+		if err := s.Save(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups := s.(*xmlDirStore).backupNames("fred@foo.com")
+	if len(backups) != 2 {
+		t.Fatal("expected 2 backups, got", backups)
+	}
+
+	/* a truncated user file falls back to the newest backup */
+	if err := ioutil.WriteFile(filepath.Join(dir, "fred@foo.com.xml"), []byte("<User><Email>fr"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	users, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users["fred@foo.com"] == nil || users["fred@foo.com"].UserWeeks[0].Points != 3 {
+		t.Error("expected fred@foo.com with 3 points from the backup, got", users["fred@foo.com"])
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"crypto/md5"
 	"crypto/tls"
 	"fmt"
 	"html/template"
@@ -30,7 +29,7 @@ import (
 // 	"ypwreset.html",
 // 	"yreset.html"))
 
-var templates = template.New("")
+var templates = template.New("").Funcs(templateFuncs)
 var templateBox *rice.Box
 
 func newTemplate(path string, _ os.FileInfo, _ error) error {
@@ -61,21 +60,19 @@ func errorPage(w http.ResponseWriter, format string, a ...interface{}) {
 	}
 }
 
-func getUserName(r *http.Request) (userName string) {
-	if cookie, err := r.Cookie("session"); err == nil {
-		userName = cookie.Value
+/* Caller must hold the store lock, at least for reading.  The
+ * season asked for with ?season=<year>, the current season if none
+ * is asked for and nil if we do not have the one asked for. */
+func requestSeason(r *http.Request) *Season {
+	yearStr := r.FormValue("season")
+	if yearStr == "" {
+		return &store.season
 	}
-	return userName
-}
-
-func clearSession(w http.ResponseWriter) {
-	cookie := &http.Cookie{
-		Name:   "session",
-		Value:  "",
-		Path:   "/",
-		MaxAge: -1,
+	year, err := strconv.Atoi(yearStr)
+	if err != nil {
+		return nil
 	}
-	http.SetCookie(w, cookie)
+	return seasonFor(year)
 }
 
 func registerGetHandler(w http.ResponseWriter, r *http.Request) {
@@ -86,29 +83,23 @@ func registerGetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+/* Caller must hold the store lock, at least for reading.  Whether
+ * email and nick are still free for a new user. */
+func registerCheck(email string, nick string) error {
+	if _, found := store.users[email]; found {
+		return fmt.Errorf("email %s already registered", email)
+	}
+	return validateNickname(nick, nil)
+}
+
 func registerPostHandler(w http.ResponseWriter, r *http.Request) {
 	email := r.FormValue("email")
 	pass := r.FormValue("password")
 	pas2 := r.FormValue("password2")
 	nick := r.FormValue("nickname")
 
-	if len(pass) == 0 {
-		errorPage(w, "no password entered")
-		return
-	}
-
-	if pass != pas2 {
-		errorPage(w, "passwords do not agree")
-		return
-	}
-
-	if len(nick) == 0 {
-		errorPage(w, "no nickname entered")
-		return
-	}
-
-	if len(nick) > 20 {
-		errorPage(w, "nickname must be less than 20 characters")
+	if err := validatePassword(pass, pas2); err != nil {
+		errorPage(w, "%s", err.Error())
 		return
 	}
 
@@ -152,36 +143,37 @@ func registerPostHandler(w http.ResponseWriter, r *http.Request) {
 		log.Println("regular expression error for email regexp", err.Error())
 	}
 
-	_, found := users[email]
-	if found {
-		errorPage(w, "email %s already registered", email)
+	/* bcrypt is slow on purpose, so hash the password without
+	 * holding the store and lock it to check again and add the user */
+	store.RLock()
+	err = registerCheck(email, nick)
+	store.RUnlock()
+	if err != nil {
+		errorPage(w, "%s", err.Error())
 		return
 	}
 
-	for _, u := range users {
-		if nick == u.Name {
-			errorPage(w, "nickname %s already used", nick)
-			return
-		}
-	}
-
 	/* hash the password */
-	pwHash := fmt.Sprintf("%x", md5.Sum([]byte(pass)))
-
-	users[email] = &User{Email: email, Name: nick, PwHash: pwHash, UserWeeks: make([]UserWeek, len(season.Week))}
-	for i, _ := range users[email].UserWeeks {
-		users[email].UserWeeks[i].Num = i + 1
+	pwHash, err := hashPassword(pass)
+	if err != nil {
+		log.Println("register: cannot hash password for", email, ":", err.Error())
+		errorPage(w, "Internal error, could not register %s", email)
+		return
 	}
-	log.Println("login: created user", email, nick, pwHash)
 
-	cookie := &http.Cookie{
-		Name:  "session",
-		Value: email,
-		Path:  "/",
+	store.Lock()
+	defer store.Unlock()
+	if err := registerCheck(email, nick); err != nil {
+		errorPage(w, "%s", err.Error())
+		return
 	}
-	http.SetCookie(w, cookie)
 
-	writeUserFile(users[email])
+	store.users[email] = &User{Email: email, Name: nick, PwHash: pwHash, Season: store.season.Year, UserWeeks: newUserWeeks(len(store.season.Week))}
+	log.Println("login: created user", email, nick)
+
+	setSession(w, store.users[email])
+
+	writeUserFile(store.users[email])
 
 	http.Redirect(w, r, "/user", http.StatusFound)
 }
@@ -202,7 +194,7 @@ func pwresetGetHandler(w http.ResponseWriter, r *http.Request) {
 	token := values.Get("token")
 	email := Login(token, []byte(options.PwRecoverSecret))
 
-	_, ok := users[email]
+	_, ok := store.users[email]
 	if !ok {
 		log.Println("Password get handler, account", email, "does not exist")
 		errorPage(w, "Password reset failed, account %s does not exist", email)
@@ -234,7 +226,15 @@ func pwresetPostHandler(w http.ResponseWriter, r *http.Request) {
 	token := values.Get("token")
 	email := Login(token, []byte(options.PwRecoverSecret))
 
-	user, ok := users[email]
+	/* bcrypt is slow on purpose, so hash the password without
+	 * holding the store and lock it only to save the hash */
+	store.RLock()
+	user, ok := store.users[email]
+	gen := 0
+	if ok {
+		gen = user.SessionGen
+	}
+	store.RUnlock()
 	if !ok {
 		log.Println("Password post handler, account", email, "does not exist")
 		errorPage(w, "Password reset failed, account %s does not exist", email)
@@ -244,23 +244,39 @@ func pwresetPostHandler(w http.ResponseWriter, r *http.Request) {
 	pass := r.FormValue("password")
 	pas2 := r.FormValue("password2")
 
-	if len(pass) == 0 {
-		errorPage(w, "no password entered")
+	if err := validatePassword(pass, pas2); err != nil {
+		errorPage(w, "%s", err.Error())
 		return
 	}
 
-	if pass != pas2 {
-		errorPage(w, "passwords do not agree")
+	/* hash the password */
+	pwHash, err := hashPassword(pass)
+	if err != nil {
+		log.Println("password reset: cannot hash password for", email, ":", err.Error())
+		errorPage(w, "Internal error, password reset failed for %s", email)
 		return
 	}
 
-	/* hash the password */
-	pwHash := fmt.Sprintf("%x", md5.Sum([]byte(pass)))
+	store.Lock()
+	defer store.Unlock()
+	/* unless the account changed while we hashed */
+	if store.users[email] != user || user.SessionGen != gen {
+		log.Println("password reset: account", email, "changed during the reset")
+		errorPage(w, "Password reset failed for %s, please try again", email)
+		return
+	}
 	user.PwHash = pwHash
+	user.SessionGen++ // log out everywhere
 	log.Println("password reset for", email)
 
 	writeUserFile(user)
 
+	err = emailUser(user, EmailSecurity, "FB Confidence Pool Password Changed",
+		"hi\nThe password for your account was reset.\n")
+	if err != nil {
+		log.Println("queueing password changed email to", user.Email, "failed:", err.Error())
+	}
+
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
@@ -316,18 +332,28 @@ func pwresetReqPostHandler(w http.ResponseWriter, r *http.Request) {
 		log.Println("regular expression error for email regexp", err.Error())
 	}
 
-	_, found := users[email]
+	user, found := store.users[email]
 	if !found {
 		errorPage(w, "No registered user with email %s is registered", email)
 		return
 	}
 
+	if user.Disabled {
+		errorPage(w, "Account %s is disabled", email)
+		return
+	}
+
 	cookie := NewSinceNow(email, 24*time.Hour, []byte(options.PwRecoverSecret))
 
 	body := "hi\nPlease click this link to reset your password\n" +
 		"https://fpkoehler.dyndns.org/reset?token=" + cookie + "\n"
 
-	sendEmail(email, "FB Confidence Pool Password Reset", body)
+	err = emailUser(user, EmailPwReset, "FB Confidence Pool Password Reset", body)
+	if err != nil {
+		log.Println("queueing password reset email to", email, "failed:", err.Error())
+		errorPage(w, "Could not send email to %s, please try again later", email)
+		return
+	}
 
 	errorPage(w, "email sent to %s", email)
 }
@@ -363,31 +389,58 @@ func loginPostHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, redirectTarget, http.StatusFound)
 	}
 
-	/* hash the password */
-	pwHash := fmt.Sprintf("%x", md5.Sum([]byte(pass)))
-	log.Println("login attempt user:", name, " hash:", pwHash)
+	log.Println("login attempt user:", name)
 
-	user, ok := users[name]
+	/* bcrypt is slow on purpose, so check the password without
+	 * holding the store and lock it only to save a new hash */
+	store.RLock()
+	user, ok := store.users[name]
+	var check User
+	if ok {
+		check = User{PwHash: user.PwHash, Disabled: user.Disabled}
+	}
+	store.RUnlock()
 	if !ok {
 		log.Println("Account", name, "does not exist")
 		errorPage(w, "Account %s does not exist, please register", name)
 		return
 	}
 
-	if pwHash != user.PwHash {
-		log.Println("login: password check failed, pwHash ", pwHash, "name.pwHash", user.PwHash)
+	pwOk, rehash := checkPassword(&check, pass)
+	if !pwOk {
+		log.Println("login: password check failed for", name)
 		errorPage(w, "Password failed for %s", name)
 		return
 	}
 
+	if check.Disabled {
+		log.Println("login: account", name, "is disabled")
+		errorPage(w, "Account %s is disabled", name)
+		return
+	}
+
 	log.Println("login: found user", name)
 
-	cookie := &http.Cookie{
-		Name:  "session",
-		Value: name,
-		Path:  "/",
+	/* upgrade an old style (MD5) password hash now that we know the password */
+	if rehash {
+		pwHash, err := hashPassword(pass)
+		if err != nil {
+			log.Println("login: cannot rehash password for", name, ":", err.Error())
+		} else {
+			store.Lock()
+			/* unless the password changed while we hashed */
+			if user.PwHash == check.PwHash {
+				log.Println("login: upgraded password hash for", name)
+				user.PwHash = pwHash
+				writeUserFile(user)
+			}
+			store.Unlock()
+		}
 	}
-	http.SetCookie(w, cookie)
+
+	store.RLock()
+	setSession(w, user)
+	store.RUnlock()
 
 	redirectTarget = "/user"
 
@@ -395,40 +448,47 @@ func loginPostHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func logoutPostHandler(w http.ResponseWriter, r *http.Request) {
-	userName := getUserName(r)
+	userName, _ := getSessionLogin(r)
 	log.Println("logout user", userName)
 	clearSession(w)
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
 func userGetHandler(w http.ResponseWriter, r *http.Request) {
-	userName := getUserName(r)
-	if userName == "" {
+	user := getSessionUser(r)
+	if user == nil {
 		http.Error(w, "no user logged in", http.StatusInternalServerError)
 		return
 	}
 
-	user, ok := users[userName]
-	if !ok {
-		http.Error(w, "no user for "+userName, http.StatusInternalServerError)
+	season := requestSeason(r)
+	if season == nil {
+		errorPage(w, "No season %s", r.FormValue("season"))
 		return
 	}
+	current := season == &store.season
 
 	type WeekRow struct {
 		Num       int
+		Name      string
 		Indx      int
 		StartDate string
 		EndDate   string
 		User      string
 	}
 
-	/* List of weeks to see results */
+	/* List of weeks to see results, all of them for a past season */
+	lastIWeek := len(season.Week) - 1
+	if current {
+		lastIWeek = store.iWeek
+	}
 	results := make([]WeekRow, 0, len(season.Week))
-	for i := 0; i <= iWeek; i++ {
+	for i := 0; i <= lastIWeek; i++ {
 		if i < len(season.Week) {
 			f := WeekRow{
 				Indx:      i,
 				Num:       i + 1,
+				Name:      season.Week[i].name(),
 				StartDate: season.Week[i].weekStart.Format("Mon Jan _2"),
 				EndDate:   season.Week[i].weekEnd.Format("Mon Jan _2"),
 				User:      user.Email,
@@ -437,13 +497,14 @@ func userGetHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	/* List of weeks to choose picks */
+	/* List of weeks to choose picks, past seasons are read only */
 	picks := make([]WeekRow, 0, len(season.Week))
-	for i := iWeek; i < len(season.Week); i++ {
+	for i := store.iWeek; current && i < len(season.Week); i++ {
 		if i < len(season.Week) {
 			f := WeekRow{
 				Indx:      i,
 				Num:       i + 1,
+				Name:      season.Week[i].name(),
 				StartDate: season.Week[i].weekStart.Format("Mon Jan _2"),
 				EndDate:   season.Week[i].weekEnd.Format("Mon Jan _2"),
 				User:      user.Email,
@@ -460,11 +521,11 @@ func userGetHandler(w http.ResponseWriter, r *http.Request) {
 	/* User Stats */
 	weeksPlayed := 0
 	totalPoints := 0
-	for i, _ := range season.Week {
-		if user.UserWeeks[i].Selections != nil {
+	for _, uw := range user.weeks(season.Year) {
+		if uw.Selections != nil {
 			weeksPlayed++
 		}
-		totalPoints += user.UserWeeks[i].Points
+		totalPoints += uw.Points
 	}
 	userStats := make([]UserStatRow, 0)
 	userStats = append(userStats, UserStatRow{"Weeks Played", strconv.Itoa(weeksPlayed)})
@@ -477,17 +538,35 @@ func userGetHandler(w http.ResponseWriter, r *http.Request) {
 	data := struct {
 		Name      string
 		Date      string
+		Year      int
+		Current   bool
+		Years     []int
 		Picks     []WeekRow
 		Results   []WeekRow
 		Standings []StandingRow
+		Playoffs  []StandingRow
 		Stats     []UserStatRow
+		Leagues   []*League
+		Admin     bool
+		Survivor  bool
+		ATS       bool
+		Ledger    bool
 	}{
 		Name:      user.Name,
 		Date:      time.Now().Format("Mon Jan _2 MST"),
+		Year:      season.Year,
+		Current:   current,
+		Years:     seasonYears(),
 		Picks:     picks,
 		Results:   results,
-		Standings: getStandings(),
+		Standings: seasonStandings(season.Year, defaultLeague(user)),
+		Playoffs:  playoffStandings(season.Year, defaultLeague(user)),
 		Stats:     userStats,
+		Leagues:   leaguesOf(user),
+		Admin:     isAdmin(user),
+		Survivor:  len(survivorLeagues(user)) > 0,
+		ATS:       defaultLeague(user).ats(),
+		Ledger:    len(ledgersOf(user)) > 0,
 	}
 
 	err := templates.ExecuteTemplate(w, "user.html", &data)
@@ -497,42 +576,169 @@ func userGetHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func profileGetHandler(w http.ResponseWriter, r *http.Request) {
-	userName := getUserName(r)
-	if userName == "" {
+	user := getSessionUser(r)
+	if user == nil {
 		http.Error(w, "no user logged in", http.StatusInternalServerError)
 		return
 	}
 
-	user, ok := users[userName]
-	if !ok {
-		http.Error(w, "no user for "+userName, http.StatusInternalServerError)
+	err := templates.ExecuteTemplate(w, "profile.html", user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func updatePasswordGetHandler(w http.ResponseWriter, r *http.Request) {
+	user := getSessionUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/", http.StatusFound)
 		return
 	}
 
-	err := templates.ExecuteTemplate(w, "profile.html", user)
+	err := templates.ExecuteTemplate(w, "updatepw.html", user)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
-func resultGetHandler(w http.ResponseWriter, r *http.Request) {
-	userName := getUserName(r)
-	if userName == "" {
-		http.Error(w, "no user logged in", http.StatusInternalServerError)
+func updatePasswordPostHandler(w http.ResponseWriter, r *http.Request) {
+	/* bcrypt is slow on purpose, so check and hash the passwords
+	 * without holding the store and lock it only to save the hash */
+	store.RLock()
+	user := getSessionUser(r)
+	var check User
+	if user != nil {
+		check = User{PwHash: user.PwHash}
+	}
+	store.RUnlock()
+	if user == nil {
+		http.Redirect(w, r, "/", http.StatusFound)
 		return
 	}
 
-	user, ok := users[userName]
-	if !ok {
-		http.Error(w, "no user for "+userName, http.StatusInternalServerError)
+	current := r.FormValue("current")
+	pass := r.FormValue("password")
+	pas2 := r.FormValue("password2")
+
+	if pwOk, _ := checkPassword(&check, current); !pwOk {
+		log.Println("update password: current password check failed for", user.Email)
+		errorPage(w, "Current password is not correct")
+		return
+	}
+
+	if err := validatePassword(pass, pas2); err != nil {
+		errorPage(w, "%s", err.Error())
+		return
+	}
+
+	pwHash, err := hashPassword(pass)
+	if err != nil {
+		log.Println("update password: cannot hash password for", user.Email, ":", err.Error())
+		errorPage(w, "Internal error, password update failed")
+		return
+	}
+
+	store.Lock()
+	defer store.Unlock()
+	/* unless the session ended or the password changed while we hashed */
+	if getSessionUser(r) != user || user.PwHash != check.PwHash {
+		log.Println("update password: account", user.Email, "changed during the update")
+		errorPage(w, "Password update failed, please try again")
+		return
+	}
+	user.PwHash = pwHash
+
+	/* log out all other sessions, then give this browser a new one */
+	user.SessionGen++
+	log.Println("password updated for", user.Email)
+
+	writeUserFile(user)
+
+	err = emailUser(user, EmailSecurity, "FB Confidence Pool Password Changed",
+		"hi\nThe password for your account was updated from the profile page.\n")
+	if err != nil {
+		log.Println("queueing password changed email to", user.Email, "failed:", err.Error())
+	}
+
+	setSession(w, user)
+
+	http.Redirect(w, r, "/profile", http.StatusFound)
+}
+
+func emailSubscribeGetHandler(w http.ResponseWriter, r *http.Request) {
+	user := getSessionUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+
+	err := templates.ExecuteTemplate(w, "subscribe.html", user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func emailSubscribePostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getSessionUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+
+	/* unchecked checkboxes are not sent with the form */
+	user.Subscribe = r.FormValue("subscribe") != ""
+	user.EmailPrefs.Reminders = r.FormValue("reminders") != ""
+	user.EmailPrefs.WeeklyResults = r.FormValue("results") != ""
+	user.EmailPrefs.Security = r.FormValue("security") != ""
+	log.Println("email preferences for", user.Email, "subscribe", user.Subscribe, user.EmailPrefs)
+
+	writeUserFile(user)
+
+	http.Redirect(w, r, "/profile", http.StatusFound)
+}
+
+/* Mail waiting to go out, and mail that could not be sent */
+func outboxGetHandler(w http.ResponseWriter, r *http.Request) {
+	user := getSessionUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+
+	if !isAdmin(user) {
+		log.Println("outbox: user", user.Email, "is not an admin")
+		http.Error(w, "not allowed", http.StatusForbidden)
+		return
+	}
+
+	data := struct {
+		Name    string
+		Pending []OutboxMail
+		Failed  []OutboxMail
+	}{
+		Name:    user.Name,
+		Pending: readOutbox("pending"),
+		Failed:  readOutbox("failed"),
+	}
+
+	err := templates.ExecuteTemplate(w, "outbox.html", &data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func resultGetHandler(w http.ResponseWriter, r *http.Request) {
+	user := getSessionUser(r)
+	if user == nil {
+		http.Error(w, "no user logged in", http.StatusInternalServerError)
 		return
 	}
 
 	/* path will look something like /results/fred/1
 	 * where fred is the player and 1 is the week index.
 	 * Note that for this form, we might be showing the
-	 * results for another user/player.  The userName is
-	 * the user logged in, player will be who we want to show
+	 * results for another user/player.  The user is
+	 * the one logged in, player will be who we want to show
 	 * the results for */
 	f := func(c rune) bool { return c == '/' }
 	fields := strings.FieldsFunc(html.EscapeString(r.URL.Path), f)
@@ -542,122 +748,93 @@ func resultGetHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "bad result URL "+r.URL.Path+" expected 3 fields", http.StatusInternalServerError)
 	}
 
-	player, ok := users[fields[1]]
-	if !ok {
+	player, ok := store.users[fields[1]]
+	if !ok || !canView(user, player) {
 		log.Println("no player for", fields[1], "URL:", r.URL.Path)
 		http.Error(w, "no player for "+fields[1], http.StatusInternalServerError)
 		return
 	}
 
+	season := requestSeason(r)
+	if season == nil {
+		errorPage(w, "No season %s", r.FormValue("season"))
+		return
+	}
+
 	iw, err := strconv.Atoi(fields[2])
-	if err != nil {
+	if err != nil || iw < 0 || iw >= len(season.Week) {
 		log.Println("user", user, "result week", r.URL.Path, "does not exist")
-		http.Error(w, "user "+userName+" "+r.URL.Path+" does not exist", http.StatusInternalServerError)
+		http.Error(w, "user "+user.Email+" "+r.URL.Path+" does not exist", http.StatusInternalServerError)
 		return
 	}
 
-	/* Build data for the results table */
-	type ResultsRow struct {
-		Time       string
-		TeamV      string
-		TeamH      string
-		Pick       string
-		Confidence int
-		Winner     string
-		Points     int
+	league, err := requestLeague(r, user)
+	if err != nil {
+		errorPage(w, "%s", err.Error())
+		return
+	}
+	leagueQuery := ""
+	if league != nil && league.ID != "" {
+		leagueQuery = "&league=" + league.ID
 	}
 
-	finished := make([]ResultsRow, 0)
-	inProgress := make([]ResultsRow, 0)
-	future := make([]ResultsRow, 0)
+	weeks := league.weeks(player, season.Year)
+	finished, inProgress, future := weekResults(season, weeks, iw, league.ats())
+	if league.survivor() && player != user {
+		/* keep the survivor pick secret until the game starts */
+		future = make([]ResultsRow, 0)
+	}
 
-	for _, s := range player.UserWeeks[iw].Selections {
-		var game Game
-		found := false
-		for _, game = range season.Week[iw].Games {
-			if s.Team == game.TeamH || s.Team == game.TeamV {
-				found = true
-				break
-			}
-		}
+	/* Build data for the players table, just the
+	 * league's members if we are looking at a league,
+	 * ranked with the tiebreaker */
+	type PlayerRow struct {
+		URL        string
+		User       string
+		Points     int
+		Tiebreaker int
+		Won        bool
+	}
 
-		if !found {
-			log.Println("Results game not found for weekIndx", iw, "selection", s)
+	owner := make(map[*UserWeek]*User)
+	weekly := make([]*UserWeek, 0, len(store.users))
+	for _, u := range store.users {
+		if !league.includes(u) {
 			continue
 		}
-
-		points := 0
-		winner := "tie"
-		time := game.Time
-
-		if game.Status == Future {
-			time = game.Day.AddDayTime(game.Time).Format("Mon Jan _2 3:04:05PM MST")
-		}
-
-		if game.Status == InProgress || game.Status == Finished {
-			/* get current score */
-			scoreV, err := strconv.Atoi(game.ScoreV)
-			if err != nil {
-				continue
-			}
-			scoreH, err := strconv.Atoi(game.ScoreH)
-			if err != nil {
-				continue
-			}
-
-			if scoreH > scoreV {
-				winner = game.TeamH
-			}
-
-			if scoreH < scoreV {
-				winner = game.TeamV
-			}
-
-			if s.Team == winner {
-				points = s.Confidence
-			}
-		}
-
-		resultsRow := ResultsRow{
-			Time:       time,
-			TeamV:      game.TeamV,
-			TeamH:      game.TeamH,
-			Pick:       s.Team,
-			Confidence: s.Confidence,
-			Winner:     winner,
-			Points:     points,
-		}
-
-		switch game.Status {
-		case Future:
-			future = append(future, resultsRow)
-		case InProgress:
-			inProgress = append(inProgress, resultsRow)
-		case Finished:
-			finished = append(finished, resultsRow)
+		uWeeks := league.weeks(u, season.Year)
+		if iw >= len(uWeeks) {
+			continue
 		}
+		owner[&uWeeks[iw]] = u
+		weekly = append(weekly, &uWeeks[iw])
 	}
+	rankWeek(&season.Week[iw], weekly)
+	won := weekWinners(&season.Week[iw], weekly)
 
-	/* Build data for the players table */
-	type PlayerRow struct {
-		URL    string
-		User   string
-		Points int
-	}
-
-	players := make([]PlayerRow, 0)
-	for _, u := range users {
+	players := make([]PlayerRow, 0, len(weekly))
+	for i, uw := range weekly {
+		u := owner[uw]
 		playerRow := PlayerRow{
-			URL:    fmt.Sprintf("/results/%s/%d", u.Email, iw),
-			User:   u.Name,
-			Points: u.UserWeeks[iw].Points,
+			URL:        fmt.Sprintf("/results/%s/%d?season=%d%s", u.Email, iw, season.Year, leagueQuery),
+			User:       u.Name,
+			Points:     uw.Points,
+			Tiebreaker: uw.Tiebreaker,
+			Won:        won[i] && season.Week[iw].finished(),
 		}
 		players = append(players, playerRow)
 	}
 
+	points := 0
+	if iw < len(weeks) {
+		points = weeks[iw].Points
+	}
+
 	data := struct {
 		User       string
+		Year       int
 		UWeek      int
+		WeekName   string
 		IWeek      int
 		Points     int
 		Player     string
@@ -665,16 +842,20 @@ func resultGetHandler(w http.ResponseWriter, r *http.Request) {
 		InProgress []ResultsRow
 		Future     []ResultsRow
 		Players    []PlayerRow
+		Tiebreaker *Game
 	}{
 		User:       user.Name,
+		Year:       season.Year,
 		UWeek:      season.Week[iw].Num,
+		WeekName:   season.Week[iw].name(),
 		IWeek:      iw,
-		Points:     player.UserWeeks[iw].Points,
+		Points:     points,
 		Player:     player.Name,
 		Finished:   finished,
 		InProgress: inProgress,
 		Future:     future,
 		Players:    players,
+		Tiebreaker: season.Week[iw].tiebreakerGame(),
 	}
 
 	err = templates.ExecuteTemplate(w, "result.html", &data)
@@ -683,16 +864,220 @@ func resultGetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func analyzeGetHandler(w http.ResponseWriter, r *http.Request) {
-	userName := getUserName(r)
-	if userName == "" {
-		http.Error(w, "no user logged in", http.StatusInternalServerError)
+func leaguesGetHandler(w http.ResponseWriter, r *http.Request) {
+	user := getSessionUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+
+	data := struct {
+		Name    string
+		Leagues []*League
+	}{
+		Name:    user.Name,
+		Leagues: leaguesOf(user),
+	}
+
+	err := templates.ExecuteTemplate(w, "leagues.html", &data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func leagueGetHandler(w http.ResponseWriter, r *http.Request) {
+	user := getSessionUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/", http.StatusFound)
 		return
 	}
 
-	_, ok := users[userName]
+	/* path will look something like /league/office */
+	id := strings.TrimPrefix(r.URL.Path, "/league/")
+	league, ok := store.leagues[id]
 	if !ok {
-		http.Error(w, "no user for "+userName, http.StatusInternalServerError)
+		errorPage(w, "No league %s", html.EscapeString(id))
+		return
+	}
+	if !league.isMember(user.Email) && !isAdmin(user) {
+		errorPage(w, "You are not in league %s", league.Name)
+		return
+	}
+
+	season := requestSeason(r)
+	if season == nil {
+		errorPage(w, "No season %s", r.FormValue("season"))
+		return
+	}
+
+	type WeekRow struct {
+		Name string
+		URL  string
+	}
+
+	weeks := make([]WeekRow, 0, len(season.Week))
+	for i := 0; i < standingsWeeks(season) && i < len(season.Week); i++ {
+		weeks = append(weeks, WeekRow{
+			Name: season.Week[i].name(),
+			URL:  fmt.Sprintf("/results/%s/%d?season=%d&league=%s", user.Email, i, season.Year, league.ID),
+		})
+	}
+
+	members := make([]*User, 0, len(league.Members))
+	for _, email := range league.Members {
+		if u, ok := store.users[email]; ok {
+			members = append(members, u)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+
+	data := struct {
+		Name      string
+		Email     string
+		League    *League
+		CanManage bool
+		Year      int
+		Years     []int
+		Weeks     []WeekRow
+		Members   []*User
+		Standings []StandingRow
+		Playoffs  []StandingRow
+	}{
+		Name:      user.Name,
+		Email:     user.Email,
+		League:    league,
+		CanManage: league.canManage(user),
+		Year:      season.Year,
+		Years:     seasonYears(),
+		Weeks:     weeks,
+		Members:   members,
+		Standings: seasonStandings(season.Year, league),
+		Playoffs:  playoffStandings(season.Year, league),
+	}
+
+	err := templates.ExecuteTemplate(w, "league.html", &data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func createLeaguePostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getSessionUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+
+	league, err := newLeague(r.FormValue("name"), user)
+	if err != nil {
+		errorPage(w, "%s", err.Error())
+		return
+	}
+
+	if err := saveLeagues(); err != nil {
+		log.Println("Could not save leagues:", err.Error())
+	}
+
+	http.Redirect(w, r, "/league/"+league.ID, http.StatusFound)
+}
+
+func joinLeaguePostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getSessionUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+
+	league := leagueByJoinCode(r.FormValue("code"))
+	if league == nil {
+		errorPage(w, "No league has that join code")
+		return
+	}
+
+	league.addMember(user.Email)
+	log.Println("user", user.Email, "joined league", league.ID)
+	if err := saveLeagues(); err != nil {
+		log.Println("Could not save leagues:", err.Error())
+	}
+
+	http.Redirect(w, r, "/league/"+league.ID, http.StatusFound)
+}
+
+func leagueSettingsPostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getSessionUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+
+	/* path will look something like /LeagueSettings/office */
+	id := strings.TrimPrefix(r.URL.Path, "/LeagueSettings/")
+	league, ok := store.leagues[id]
+	if !ok {
+		errorPage(w, "No league %s", html.EscapeString(id))
+		return
+	}
+
+	if r.FormValue("leave") != "" {
+		if user.Email == league.Owner {
+			errorPage(w, "The owner can not leave league %s", league.Name)
+			return
+		}
+		league.removeMember(user.Email)
+		log.Println("user", user.Email, "left league", league.ID)
+		if err := saveLeagues(); err != nil {
+			log.Println("Could not save leagues:", err.Error())
+		}
+		http.Redirect(w, r, "/leagues", http.StatusFound)
+		return
+	}
+
+	if !league.canManage(user) {
+		errorPage(w, "Only the owner can change league %s", league.Name)
+		return
+	}
+
+	switch playoffs := r.FormValue("playoffs"); playoffs {
+	case "", "separate", "combined":
+		league.Settings.PlayoffStandings = playoffs
+	default:
+		errorPage(w, "Unknown playoff standings %s", html.EscapeString(playoffs))
+		return
+	}
+
+	switch mode := r.FormValue("mode"); mode {
+	case "", "survivor", "ats":
+		league.Settings.PoolMode = mode
+	default:
+		errorPage(w, "Unknown pool %s", html.EscapeString(mode))
+		return
+	}
+
+	rules, err := parseLedgerRules(r.FormValue("fee"), r.FormValue("pot"), r.FormValue("payouts"))
+	if err != nil {
+		errorPage(w, "%s", html.EscapeString(err.Error()))
+		return
+	}
+	league.Settings.Ledger = rules
+
+	r.ParseForm()
+	for _, email := range r.Form["remove"] {
+		if email != league.Owner {
+			log.Println("user", user.Email, "removed", email, "from league", league.ID)
+			league.removeMember(email)
+		}
+	}
+
+	if err := saveLeagues(); err != nil {
+		log.Println("Could not save leagues:", err.Error())
+	}
+
+	http.Redirect(w, r, "/league/"+league.ID, http.StatusFound)
+}
+
+func analyzeGetHandler(w http.ResponseWriter, r *http.Request) {
+	if getSessionUser(r) == nil {
+		http.Error(w, "no user logged in", http.StatusInternalServerError)
 		return
 	}
 
@@ -705,34 +1090,22 @@ func analyzeGetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	fmt.Fprintln(w, "weekIndex =", week)
-	if week < 0 || week > numberOfWeeks {
+	if week < 0 || week >= len(store.season.Week) {
 		fmt.Fprintln(w, "weeks out of range")
 		return
 	}
 
-	for indx, game := range season.Week[week].Games {
+	for indx, game := range store.season.Week[week].Games {
 		fmt.Fprintln(w, indx, game.TeamV, game.TeamH)
-		for userName, user := range users {
+		for userName, user := range store.users {
 			for _, selection := range user.UserWeeks[week].Selections {
 				if selection.Team == game.TeamV || selection.Team == game.TeamH {
 					if game.Status == Finished {
-						points := 0
-						scoreV, err := strconv.Atoi(game.ScoreV)
-						if err != nil {
-							continue
-						}
-						scoreH, err := strconv.Atoi(game.ScoreH)
-						if err != nil {
+						score, ok := scorePick(&game, selection, false)
+						if !ok {
 							continue
 						}
-
-						if selection.Team == game.TeamV && scoreV > scoreH {
-							points = selection.Confidence
-						}
-						if selection.Team == game.TeamH && scoreH > scoreV {
-							points = selection.Confidence
-						}
-						fmt.Fprintln(w, " ", points, userName, selection.Team)
+						fmt.Fprintln(w, " ", score.Points, userName, selection.Team)
 						//fmt.Fprintln(w, " ", selection, game, selection.Team == game.TeamV, game.ScoreV, game.ScoreH, game.ScoreV > game.ScoreH)
 					} else {
 						fmt.Fprintln(w, " ", userName, selection.Team, selection.Confidence)
@@ -760,26 +1133,21 @@ type UserGameTmpl struct {
 	Confidence int
 	When       string
 	Status     string
+	Line       string // the spread in an ATS pool, see spread.go
 }
 
 func selectGetHandler(w http.ResponseWriter, r *http.Request) {
-	userName := getUserName(r)
-	if userName == "" {
+	user := getSessionUser(r)
+	if user == nil {
 		http.Redirect(w, r, "/", http.StatusFound)
 		return
 	}
-
-	user, ok := users[userName]
-	if !ok {
-		http.Error(w, "no user for "+userName, http.StatusInternalServerError)
-		return
-	}
 	/* path will look something like /select/1
 	 * Extract the number */
 	week, err := strconv.Atoi(strings.Trim(r.URL.Path, "/select/"))
-	if err != nil {
+	if err != nil || week < 0 || week >= len(store.season.Week) {
 		log.Println("user", user, "selected", r.URL.Path, "does not exist")
-		http.Error(w, "user "+userName+" "+r.URL.Path+" does not exist", http.StatusInternalServerError)
+		http.Error(w, "user "+user.Email+" "+r.URL.Path+" does not exist", http.StatusInternalServerError)
 		return
 	}
 	if user.UserWeeks[week].Selections == nil {
@@ -788,30 +1156,37 @@ func selectGetHandler(w http.ResponseWriter, r *http.Request) {
 		log.Println("selectGetHandler for user", user.Email, "#selections for week", week, len(user.UserWeeks[week].Selections))
 	}
 
-	numGames := len(season.Week[week].Games)
+	numGames := len(store.season.Week[week].Games)
+	maxConfidence := store.season.Week[week].maxConfidence()
 
 	/* create an anonymous struct to pass to ExecuteTemplate */
 	/* http://julianyap.com/2013/09/23/using-anonymous-structs-to-pass-data-to-templates-in-golang.html */
 	data := struct {
-		User     string
-		Week     int
-		UWeek    int
-		Points   int // TODO: is this being used?
-		NumGames int
-		Games    []UserGameTmpl
-		Started  []UserGameTmpl
+		User          string
+		Week          int
+		UWeek         int
+		WeekName      string
+		Points        int // TODO: is this being used?
+		NumGames      int
+		MaxConfidence int
+		Games         []UserGameTmpl
+		Started       []UserGameTmpl
+		Tiebreaker    *TiebreakerTmpl
 	}{
-		User:     user.Name,
-		Week:     week,
-		UWeek:    week + 1,
-		Points:   user.UserWeeks[week].Points,
-		NumGames: numGames,
+		User:          user.Name,
+		Week:          week,
+		UWeek:         week + 1,
+		WeekName:      store.season.Week[week].name(),
+		Points:        user.UserWeeks[week].Points,
+		NumGames:      numGames,
+		MaxConfidence: maxConfidence,
+		Tiebreaker:    makeTiebreakerTmpl(user, week),
 	}
 
 	data.Games = make([]UserGameTmpl, 0, numGames)
 	data.Started = make([]UserGameTmpl, 0, numGames)
-	for indx, game := range season.Week[week].Games {
-		confidence := indx + 16 - numGames + 1
+	for indx, game := range store.season.Week[week].Games {
+		confidence := indx + maxConfidence - numGames + 1
 		checkV := "checked"
 		teamSel := game.TeamV
 		checkH := ""
@@ -835,7 +1210,7 @@ func selectGetHandler(w http.ResponseWriter, r *http.Request) {
 
 		if pSelection == nil {
 			if game.Status == Future {
-				confidence = indx + 16 - numGames + 1
+				confidence = indx + maxConfidence - numGames + 1
 			} else {
 				confidence = 0
 				teamSel = "--"
@@ -872,6 +1247,7 @@ func selectGetHandler(w http.ResponseWriter, r *http.Request) {
 			Confidence: confidence,
 			When:       when,
 			Status:     status,
+			Line:       game.line(store.season.Year, len(atsLeagues(user)) > 0),
 			CSS:        css, // not used anymore
 		}
 
@@ -897,18 +1273,12 @@ func (a ByConfidence) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a ByConfidence) Less(i, j int) bool { return a[i].Confidence > a[j].Confidence }
 
 func selectDnDGetHandler(w http.ResponseWriter, r *http.Request) {
-	userName := getUserName(r)
-	if userName == "" {
+	user := getSessionUser(r)
+	if user == nil {
 		http.Redirect(w, r, "/", http.StatusFound)
 		return
 	}
 
-	user, ok := users[userName]
-	if !ok {
-		http.Error(w, "no user for "+userName, http.StatusInternalServerError)
-		return
-	}
-
 	/* this form supports selectDnD.html and selectLogo.html.
 	 * figure out which one we have. */
 	selectForm := "selectDnD"
@@ -919,9 +1289,9 @@ func selectDnDGetHandler(w http.ResponseWriter, r *http.Request) {
 	/* path will look something like /selectDnD/1
 	 * Extract the number */
 	week, err := strconv.Atoi(strings.Trim(r.URL.Path, "/"+selectForm+"/"))
-	if err != nil {
+	if err != nil || week < 0 || week >= len(store.season.Week) {
 		log.Println("user", user, "selected", r.URL.Path, "does not exist")
-		http.Error(w, "user "+userName+" "+r.URL.Path+" does not exist", http.StatusInternalServerError)
+		http.Error(w, "user "+user.Email+" "+r.URL.Path+" does not exist", http.StatusInternalServerError)
 		return
 	}
 	if user.UserWeeks[week].Selections == nil {
@@ -930,30 +1300,37 @@ func selectDnDGetHandler(w http.ResponseWriter, r *http.Request) {
 		log.Println("selectGetHandler for user", user.Email, "#selections for week", week, len(user.UserWeeks[week].Selections))
 	}
 
-	numGames := len(season.Week[week].Games)
+	numGames := len(store.season.Week[week].Games)
+	maxConfidence := store.season.Week[week].maxConfidence()
 
 	/* create an anonymous struct to pass to ExecuteTemplate */
 	/* http://julianyap.com/2013/09/23/using-anonymous-structs-to-pass-data-to-templates-in-golang.html */
 	data := struct {
-		User     string
-		Week     int
-		UWeek    int
-		Points   int // TODO: is this being used?
-		NumGames int
-		Games    []UserGameTmpl
-		Started  []UserGameTmpl
+		User          string
+		Week          int
+		UWeek         int
+		WeekName      string
+		Points        int // TODO: is this being used?
+		NumGames      int
+		MaxConfidence int
+		Games         []UserGameTmpl
+		Started       []UserGameTmpl
+		Tiebreaker    *TiebreakerTmpl
 	}{
-		User:     user.Name,
-		Week:     week,
-		UWeek:    week + 1,
-		Points:   user.UserWeeks[week].Points,
-		NumGames: numGames,
+		User:          user.Name,
+		Week:          week,
+		UWeek:         week + 1,
+		WeekName:      store.season.Week[week].name(),
+		Points:        user.UserWeeks[week].Points,
+		NumGames:      numGames,
+		MaxConfidence: maxConfidence,
+		Tiebreaker:    makeTiebreakerTmpl(user, week),
 	}
 
 	data.Games = make([]UserGameTmpl, 0, numGames)
 	data.Started = make([]UserGameTmpl, 0, numGames)
-	for indx, game := range season.Week[week].Games {
-		confidence := indx + 16 - numGames + 1
+	for indx, game := range store.season.Week[week].Games {
+		confidence := indx + maxConfidence - numGames + 1
 		checkV := "checked"
 		teamSel := game.TeamV
 		checkH := ""
@@ -977,7 +1354,7 @@ func selectDnDGetHandler(w http.ResponseWriter, r *http.Request) {
 
 		if pSelection == nil {
 			if game.Status == Future {
-				confidence = indx + 16 - numGames + 1
+				confidence = indx + maxConfidence - numGames + 1
 			} else {
 				confidence = 0
 				teamSel = "--"
@@ -1006,8 +1383,8 @@ func selectDnDGetHandler(w http.ResponseWriter, r *http.Request) {
 			Num:        indx + 1,
 			TeamV:      game.TeamV,
 			TeamH:      game.TeamH,
-			TeamLogoV:  toLogo[game.TeamV],
-			TeamLogoH:  toLogo[game.TeamH],
+			TeamLogoV:  teams.logo(game.TeamV, store.season.Year),
+			TeamLogoH:  teams.logo(game.TeamH, store.season.Year),
 			ScoreV:     game.ScoreV,
 			ScoreH:     game.ScoreH,
 			CheckedV:   checkV,
@@ -1016,6 +1393,7 @@ func selectDnDGetHandler(w http.ResponseWriter, r *http.Request) {
 			Confidence: confidence,
 			When:       when,
 			Status:     status,
+			Line:       game.line(store.season.Year, len(atsLeagues(user)) > 0),
 			CSS:        css, // not used anymore
 		}
 
@@ -1037,17 +1415,11 @@ func selectDnDGetHandler(w http.ResponseWriter, r *http.Request) {
 func selectPostHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("selectPost URL", r.URL.Path)
 
-	userName := getUserName(r)
-	if userName == "" {
+	user := getSessionUser(r)
+	if user == nil {
 		http.Redirect(w, r, "/", http.StatusFound)
 		return
 	}
-
-	user, ok := users[userName]
-	if !ok {
-		http.Error(w, "no user for "+userName, http.StatusInternalServerError)
-		return
-	}
 	log.Println("selectPostHandler for user", user.Email)
 	log.Println(r.Header)
 
@@ -1059,38 +1431,19 @@ func selectPostHandler(w http.ResponseWriter, r *http.Request) {
 	week, err := strconv.Atoi(strings.Trim(r.URL.Path, "/save/"))
 	if err != nil {
 		log.Println("user", user, "selected", r.URL.Path, "does not exist")
-		http.Error(w, "user "+userName+" "+r.URL.Path+" does not exist", http.StatusInternalServerError)
+		http.Error(w, "user "+user.Email+" "+r.URL.Path+" does not exist", http.StatusInternalServerError)
 		return
 	}
 	log.Println("User saving week", week)
 
-	if user.UserWeeks[week].Selections == nil {
-		user.UserWeeks[week].Selections = make([]Selection, 0, 16)
-	}
-
-	// var pGame *Game
-	var pSelection *Selection
-
-	when := time.Now().Round(0) // Round(0) strips monotonic clock reading
-	for _, game := range season.Week[week].Games {
-		if game.Status == InProgress || game.Status == Finished {
-			continue
-		}
-
-		if game.Status == Future {
-			gameTime := game.Day.AddDayTime(game.Time)
-			if when.After(gameTime) {
-				/* We have not updated the game status yet,
-				 * but we are past the start of the game.  */
-				log.Println("user", user.Name, "ignoring selection", game.TeamV, game.TeamH, "it started", gameTime)
-				continue
-			}
-		}
-
+	/* the form has, for each game not started, the visiting team
+	 * as the name with "home" or "visitor" as the value and
+	 * "confidence"+visiting team with the confidence */
+	choose := func(game Game) (string, int, bool) {
 		whoWins := r.FormValue(game.TeamV)
 		if whoWins == "" {
 			/* game not on form because it already started */
-			continue
+			return "", 0, false
 		}
 
 		if strings.Compare(whoWins, "home") == 0 {
@@ -1104,92 +1457,107 @@ func selectPostHandler(w http.ResponseWriter, r *http.Request) {
 		confidence, err := strconv.Atoi(confidenceStr)
 		if err != nil {
 			log.Println("Error: user", user, "selection", whoWins, "bad confidence value:", confidenceStr)
-			confidence = 16
+			confidence = store.season.Week[week].maxConfidence()
 		}
 
-		/* see if the user already made a selection for this game */
-		pSelection = nil
-		for is, s := range user.UserWeeks[week].Selections {
-			if s.Team == game.TeamV || s.Team == game.TeamH {
-				pSelection = &user.UserWeeks[week].Selections[is]
-				break
-			}
-		}
+		return whoWins, confidence, true
+	}
 
-		if pSelection == nil {
-			/* no previous selection, append to user's selections */
-			selection := Selection{Team: whoWins, Confidence: confidence, When: when.String()}
-			user.UserWeeks[week].Selections = append(user.UserWeeks[week].Selections, selection)
-		} else {
-			/* has the selection changed? If it hasn't, do nothing */
-			if pSelection.Team != whoWins || pSelection.Confidence != confidence {
-				pSelection.Team = whoWins
-				pSelection.Confidence = confidence
-				pSelection.When = when.String()
-			}
-		}
+	if err := savePicks(user, week, choose); err != nil {
+		errorPage(w, "%s", err.Error())
+		return
 	}
 
-	/* Make sure confidence values are not repeated */
-	/* 16 is the max confidence values even if there are less than 16 games.
-	 * Use range 1..16 in this array */
-	validArray := make([]string, 16+1)
-	log.Println(user.UserWeeks[week].Selections)
-	for _, s := range user.UserWeeks[week].Selections {
-		if s.Confidence > 16 {
-			log.Println("Error: user", user, "selection", s.Team, "over confidence value:", s.Confidence)
-			errorPage(w, "Confidence value of %d for %s can not be greater than 16\n",
-				s.Confidence, s.Team)
-			return
+	/* only on the form until the tiebreaker game starts */
+	if tiebreaker := r.FormValue("tiebreaker"); tiebreaker != "" {
+		total, err := strconv.Atoi(tiebreaker)
+		if err == nil {
+			err = setTiebreaker(user, week, total, false)
 		}
-		if validArray[s.Confidence] == "" {
-			validArray[s.Confidence] = s.Team
-		} else {
-			errorPage(w, "Can not reuse confidences, you have both %s and %s with a confidence of %d\n",
-				s.Team, validArray[s.Confidence], s.Confidence)
-			// user.UserWeeks[week].Selections[i].Confidence = 0
+		if err != nil {
+			errorPage(w, "Tiebreaker %s: %s", html.EscapeString(tiebreaker), err.Error())
 			return
 		}
 	}
 
-	writeUserFile(user)
-
 	/* back to main user page */
 	http.Redirect(w, r, "/user", http.StatusFound)
 }
 
-func webSrv() {
+/* All the handlers.  Handlers that use the users or the
+ * season go through storeReader or storeWriter, see store.go */
+func newMux() *http.ServeMux {
 	mux := http.NewServeMux()
 
-	// Load and parse templates (from binary or disk)
-	templateBox = rice.MustFindBox("templates")
-	templateBox.Walk("", newTemplate)
-
 	// The resources directory that contains CSS and JavaScript files
 	resourceBox := rice.MustFindBox("resources")
 	resourceFileServer := http.StripPrefix("/resources/", http.FileServer(resourceBox.HTTPBox()))
 	mux.Handle("/resources/", resourceFileServer)
 
 	/* handlers for GETs */
-	mux.HandleFunc("/", loginGetHandler)
-	mux.HandleFunc("/user", userGetHandler)
-	mux.HandleFunc("/profile", profileGetHandler)
-	mux.HandleFunc("/select/", selectGetHandler)
-	mux.HandleFunc("/selectDnD/", selectDnDGetHandler)
-	mux.HandleFunc("/selectLogo/", selectDnDGetHandler)
-	mux.HandleFunc("/results/", resultGetHandler)
-	mux.HandleFunc("/analyze/", analyzeGetHandler)
+	mux.HandleFunc("/", storeReader(loginGetHandler))
+	mux.HandleFunc("/user", storeReader(userGetHandler))
+	mux.HandleFunc("/profile", storeReader(profileGetHandler))
+	mux.HandleFunc("/update_password", storeReader(updatePasswordGetHandler))
+	mux.HandleFunc("/email_subscribe", storeReader(emailSubscribeGetHandler))
+	mux.HandleFunc("/outbox", storeReader(outboxGetHandler))
+	mux.HandleFunc("/leagues", storeReader(leaguesGetHandler))
+	mux.HandleFunc("/league/", storeReader(leagueGetHandler))
+	mux.HandleFunc("/select/", storeReader(selectGetHandler))
+	mux.HandleFunc("/selectDnD/", storeReader(selectDnDGetHandler))
+	mux.HandleFunc("/selectLogo/", storeReader(selectDnDGetHandler))
+	mux.HandleFunc("/survivor", storeReader(survivorStandingsGetHandler))
+	mux.HandleFunc("/ledger", storeReader(ledgerGetHandler))
+	mux.HandleFunc("/survivor/", storeReader(survivorGetHandler))
+	mux.HandleFunc("/results/", storeReader(resultGetHandler))
+	mux.HandleFunc("/analyze/", storeReader(analyzeGetHandler))
 	mux.HandleFunc("/register", registerGetHandler)
 	mux.HandleFunc("/pwreset", pwresetReqGetHandler)
-	mux.HandleFunc("/reset", pwresetGetHandler)
+	mux.HandleFunc("/reset", storeReader(pwresetGetHandler))
 
 	/* handlers for POSTs */
-	mux.HandleFunc("/login", loginPostHandler)
+	mux.HandleFunc("/login", loginPostHandler) /* locks the store itself */
 	mux.HandleFunc("/logout", logoutPostHandler)
-	mux.HandleFunc("/save/", selectPostHandler)
-	mux.HandleFunc("/Register", registerPostHandler)
-	mux.HandleFunc("/PwReset", pwresetReqPostHandler)
-	mux.HandleFunc("/Reset", pwresetPostHandler)
+	mux.HandleFunc("/save/", storeWriter(selectPostHandler))
+	mux.HandleFunc("/SaveSurvivor/", storeWriter(survivorPostHandler))
+	mux.HandleFunc("/Register", registerPostHandler) /* locks the store itself */
+	mux.HandleFunc("/PwReset", storeReader(pwresetReqPostHandler))
+	mux.HandleFunc("/Reset", pwresetPostHandler)                 /* locks the store itself */
+	mux.HandleFunc("/UpdatePassword", updatePasswordPostHandler) /* locks the store itself */
+	mux.HandleFunc("/EmailSubscribe", storeWriter(emailSubscribePostHandler))
+	mux.HandleFunc("/CreateLeague", storeWriter(createLeaguePostHandler))
+	mux.HandleFunc("/JoinLeague", storeWriter(joinLeaguePostHandler))
+	mux.HandleFunc("/LeagueSettings/", storeWriter(leagueSettingsPostHandler))
+
+	/* admin console, see admin.go */
+	mux.HandleFunc("/admin", storeReader(adminGetHandler))
+	mux.HandleFunc("/admin/user/", storeReader(adminUserGetHandler))
+	mux.HandleFunc("/admin/picks/", storeReader(adminPicksGetHandler))
+	mux.HandleFunc("/admin/audit", storeReader(adminAuditGetHandler))
+	mux.HandleFunc("/admin/games/", storeReader(adminGamesGetHandler))
+	mux.HandleFunc("/admin/ledger", storeReader(adminLedgerGetHandler))
+	mux.HandleFunc("/admin/User/", storeWriter(adminUserPostHandler))
+	mux.HandleFunc("/admin/Picks/", storeWriter(adminPicksPostHandler))
+	mux.HandleFunc("/admin/Rescore", storeWriter(adminRescorePostHandler))
+	mux.HandleFunc("/admin/Game/", storeWriter(adminGamePostHandler))
+	mux.HandleFunc("/admin/Ledger", storeWriter(adminLedgerPostHandler))
+
+	/* JSON API, see api.go */
+	mux.HandleFunc(apiPrefix+"weeks", storeReader(apiWeeksHandler))
+	mux.HandleFunc(apiPrefix+"weeks/", storeReader(apiWeeksHandler))
+	mux.HandleFunc(apiPrefix+"picks/", storeWriter(apiPicksHandler))
+	mux.HandleFunc(apiPrefix+"results/", storeReader(apiResultsHandler))
+	mux.HandleFunc(apiPrefix+"standings", storeReader(apiStandingsHandler))
+
+	return mux
+}
+
+func webSrv() {
+	// Load and parse templates (from binary or disk)
+	templateBox = rice.MustFindBox("templates")
+	templateBox.Walk("", newTemplate)
+
+	mux := newMux()
 
 	log.Println("Starting Web Server")
 
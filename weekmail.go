@@ -0,0 +1,89 @@
+package main
+
+/* Pick reminders and weekly results by email.
+ *
+ * A day before the first game of the week the users who have not
+ * made their picks get a reminder.  When the last game of a week is
+ * over the users who played get their points.  Both go through
+ * emailUser(), so only to users whose EmailPrefs ask for them.  Each
+ * week's mail goes out once, Week.Reminded and Week.Reported are
+ * saved with the season. */
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+/* How long before the first game of the week the reminders go out */
+const reminderLead = 24 * time.Hour
+
+/* When the week's first game starts, zero if one has started */
+func (w *Week) firstKickoff() time.Time {
+	first := time.Time{}
+	for i := range w.Games {
+		g := &w.Games[i]
+		if g.Status != Future {
+			return time.Time{}
+		}
+		if t := g.Day.AddDayTime(g.Time); first.IsZero() || t.Before(first) {
+			first = t
+		}
+	}
+	return first
+}
+
+/* Caller must hold the store lock.  Sends the reminders and results
+ * that are due, returns true if the season changed and needs to be
+ * saved. */
+func sendWeekMail(now time.Time) bool {
+	if store.iWeek < 0 || store.iWeek >= len(store.season.Week) {
+		return false
+	}
+	changed := false
+
+	iw := store.iWeek
+	week := &store.season.Week[iw]
+	first := week.firstKickoff()
+	if !week.Reminded && !first.IsZero() && now.After(first.Add(-reminderLead)) {
+		for _, u := range store.users {
+			if u.Disabled || iw >= len(u.UserWeeks) || u.UserWeeks[iw].Selections != nil {
+				continue
+			}
+			body := fmt.Sprintf("hi %s\nYou have not made your picks for %s, the first game starts %s.\n",
+				u.Name, week.name(), first.Format("Mon Jan _2 3:04PM MST"))
+			if err := emailUser(u, EmailReminder, "FB Confidence Pool "+week.name()+" picks", body); err != nil {
+				log.Println("queueing reminder to", u.Email, "failed:", err.Error())
+			}
+		}
+		week.Reminded = true
+		changed = true
+	}
+
+	/* the week that just finished, the ones before it are old news */
+	for i := 0; i <= iw; i++ {
+		w := &store.season.Week[i]
+		if w.Reported || !w.finished() {
+			continue
+		}
+		w.Reported = true
+		changed = true
+		if i < iw-1 {
+			continue
+		}
+
+		for _, u := range store.users {
+			if u.Disabled || i >= len(u.UserWeeks) || u.UserWeeks[i].Selections == nil {
+				continue
+			}
+			uw := &u.UserWeeks[i]
+			body := fmt.Sprintf("hi %s\nYou scored %d points in %s with %d good picks.\n",
+				u.Name, uw.Points, w.name(), uw.GoodPicks)
+			if err := emailUser(u, EmailResults, "FB Confidence Pool "+w.name()+" results", body); err != nil {
+				log.Println("queueing results to", u.Email, "failed:", err.Error())
+			}
+		}
+	}
+
+	return changed
+}
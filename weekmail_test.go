@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWeekMail(t *testing.T) {
+	newTestStore(t, 2021, []Game{finalGame("CHI", "GB", 21, 7, 1)}, []Game{futureGame("NYJ", "NYG", 1)})
+	store.iWeek = 1
+	initOutbox()
+
+	for _, name := range []string{"fred", "barney", "wilma"} {
+		u := addTestUser(name)
+		u.Subscribe = true
+		u.EmailPrefs = EmailPrefs{Reminders: true, WeeklyResults: true}
+	}
+	/* fred played week 1 and picked week 2, barney played week 1,
+	 * wilma only wants her results */
+	store.users["fred@foo.com"].UserWeeks[0].Selections = []Selection{{Team: "CHI", Confidence: 1}}
+	store.users["fred@foo.com"].UserWeeks[1].Selections = []Selection{{Team: "NYJ", Confidence: 1}}
+	store.users["barney@foo.com"].UserWeeks[0].Selections = []Selection{{Team: "GB", Confidence: 1}}
+	store.users["wilma@foo.com"].EmailPrefs.Reminders = false
+
+	/* too early for the reminders, week 1's results go out */
+	kickoff := store.season.Week[1].firstKickoff()
+	if !sendWeekMail(kickoff.Add(-2 * reminderLead)) {
+		t.Error("results not sent")
+	}
+	if n := len(readOutbox("pending")); n != 2 {
+		t.Error("expected results for fred and barney, got", n)
+	}
+
+	/* the reminder goes to barney, once */
+	if !sendWeekMail(kickoff.Add(-time.Hour)) || sendWeekMail(kickoff.Add(-time.Hour)) {
+		t.Error("reminders not sent once")
+	}
+	reminders := make([]string, 0)
+	for _, m := range readOutbox("pending") {
+		if strings.HasSuffix(m.Subject, "picks") {
+			reminders = append(reminders, m.To)
+		}
+	}
+	if len(reminders) != 1 || reminders[0] != "barney@foo.com" {
+		t.Error("expected a reminder to barney, got", reminders)
+	}
+}